@@ -0,0 +1,6 @@
+--
+-- Мягкое удаление заметок: время удаления записывается в `deleted_at`,
+-- а неудаленные заметки имеют в этом столбце NULL.
+--
+ALTER TABLE `snippets`
+  ADD COLUMN `deleted_at` datetime NULL DEFAULT NULL;
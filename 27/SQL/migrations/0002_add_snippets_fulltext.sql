@@ -0,0 +1,5 @@
+--
+-- Полнотекстовый индекс для поиска по заголовкам и содержимому заметок.
+--
+ALTER TABLE `snippets`
+  ADD FULLTEXT KEY `idx_snippets_fulltext` (`title`, `content`);
@@ -0,0 +1,19 @@
+--
+-- Теги заметок. Связь многие-ко-многим хранится в таблице `snippet_tags`,
+-- записи которой удаляются вместе с заметкой.
+--
+CREATE TABLE `tags` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `name` varchar(50) COLLATE utf8mb4_unicode_ci NOT NULL,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `tags_uc_name` UNIQUE (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE `snippet_tags` (
+  `snippet_id` int NOT NULL,
+  `tag_id` int NOT NULL,
+  PRIMARY KEY (`snippet_id`, `tag_id`),
+  KEY `idx_snippet_tags_tag_id` (`tag_id`),
+  CONSTRAINT `fk_snippet_tags_snippet` FOREIGN KEY (`snippet_id`) REFERENCES `snippets` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fk_snippet_tags_tag` FOREIGN KEY (`tag_id`) REFERENCES `tags` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,7 @@
+--
+-- Автор заметки. Для анонимных заметок `user_id` содержит NULL.
+--
+ALTER TABLE `snippets`
+  ADD COLUMN `user_id` int NULL DEFAULT NULL,
+  ADD KEY `idx_snippets_user_id` (`user_id`),
+  ADD CONSTRAINT `fk_snippets_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE SET NULL;
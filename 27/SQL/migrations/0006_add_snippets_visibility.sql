@@ -0,0 +1,7 @@
+--
+-- Видимость заметки: public - в общих списках, unlisted - только по прямой
+-- ссылке, private - только для автора.
+--
+ALTER TABLE `snippets`
+  ADD COLUMN `visibility` ENUM('public', 'unlisted', 'private') NOT NULL DEFAULT 'public',
+  ADD KEY `idx_snippets_visibility` (`visibility`);
@@ -0,0 +1,21 @@
+--
+-- Новые пользователи должны подтвердить email адрес, прежде чем войти.
+-- Уже зарегистрированные пользователи считаются активированными.
+--
+ALTER TABLE `users`
+  ADD COLUMN `activated` BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE `users` SET `activated` = TRUE;
+
+--
+-- Токены активации. В таблице хранится только SHA-256 хеш токена,
+-- сам токен отправляется пользователю в ссылке.
+--
+CREATE TABLE `tokens` (
+  `hash` binary(32) NOT NULL,
+  `user_id` int NOT NULL,
+  `expiry` datetime NOT NULL,
+  PRIMARY KEY (`hash`),
+  KEY `idx_tokens_user_id` (`user_id`),
+  CONSTRAINT `fk_tokens_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
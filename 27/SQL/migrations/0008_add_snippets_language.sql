@@ -0,0 +1,6 @@
+--
+-- Язык программирования заметки для подсветки синтаксиса.
+-- Значение none означает обычный текст.
+--
+ALTER TABLE `snippets`
+  ADD COLUMN `language` varchar(32) NOT NULL DEFAULT 'none';
@@ -0,0 +1,5 @@
+--
+-- Количество просмотров страницы заметки.
+--
+ALTER TABLE `snippets`
+  ADD COLUMN `view_count` int unsigned NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+--
+-- Заметки без срока жизни хранят NULL в столбце `expires`.
+--
+ALTER TABLE `snippets`
+  MODIFY COLUMN `expires` datetime NULL DEFAULT NULL;
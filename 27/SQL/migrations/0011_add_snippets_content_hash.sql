@@ -0,0 +1,8 @@
+--
+-- SHA-256 нормализованных заголовка и содержимого заметки для поиска
+-- повторно отправленных заметок того же автора. Индекс не уникальный:
+-- одинаковые заметки допустимы, если предыдущая уже истекла или удалена.
+--
+ALTER TABLE `snippets`
+  ADD COLUMN `content_hash` char(64) NULL DEFAULT NULL,
+  ADD KEY `idx_snippets_user_content_hash` (`user_id`, `content_hash`);
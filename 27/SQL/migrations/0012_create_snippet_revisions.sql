@@ -0,0 +1,14 @@
+--
+-- Предыдущие версии заметок. Перед каждым изменением заметки её текущие
+-- заголовок и содержимое копируются сюда. Версии удаляются вместе с заметкой.
+--
+CREATE TABLE `snippet_revisions` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `snippet_id` int NOT NULL,
+  `title` varchar(100) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `content` text COLLATE utf8mb4_unicode_ci NOT NULL,
+  `created` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_snippet_revisions_snippet_id` (`snippet_id`),
+  CONSTRAINT `fk_snippet_revisions_snippet` FOREIGN KEY (`snippet_id`) REFERENCES `snippets` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,7 @@
+--
+-- ID заметки, копия которой была создана. При окончательном удалении
+-- исходной заметки ссылка сбрасывается в NULL.
+--
+ALTER TABLE `snippets`
+  ADD COLUMN `forked_from` int NULL DEFAULT NULL,
+  ADD CONSTRAINT `fk_snippets_forked_from` FOREIGN KEY (`forked_from`) REFERENCES `snippets` (`id`) ON DELETE SET NULL;
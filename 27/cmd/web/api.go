@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Slava02/SnippetBox/26/pkg/forms"
+	"github.com/Slava02/SnippetBox/26/pkg/models"
+)
+
+// envelope оборачивает данные JSON ответа в объект верхнего уровня,
+// например {"snippet": {...}}.
+type envelope map[string]interface{}
+
+// apiSnippetList возвращает последние заметки в формате JSON.
+func (app *application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	s, err := app.snippets.Latest(r.Context())
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	// Если заметок нет, возвращаем пустой массив, а не null.
+	if s == nil {
+		s = []*models.Snippet{}
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippets": s})
+}
+
+// apiSnippetView возвращает одну заметку в формате JSON.
+func (app *application) apiSnippetView(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiError(w, http.StatusNotFound, "заметка не найдена")
+		return
+	}
+
+	s, err := app.snippets.Get(r.Context(), id, 0)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiError(w, http.StatusNotFound, "заметка не найдена")
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippet": s})
+}
+
+// apiOptions отвечает на OPTIONS запросы к API, которые не являются
+// CORS preflight запросами от доверенного источника.
+func (app *application) apiOptions(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiSnippetCreate создает новую заметку из JSON тела запроса.
+func (app *application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title      string   `json:"title"`
+		Content    string   `json:"content"`
+		Expires    *int     `json:"expires"`
+		Visibility string   `json:"visibility"`
+		Language   string   `json:"language"`
+		Tags       []string `json:"tags"`
+	}
+
+	// Тело, которое не удалось разобрать, получает ответ 400, а ошибки
+	// валидации корректного JSON - ответ 422.
+	err := app.readJSON(r, &input)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.bodyTooLarge(w, r)
+			return
+		}
+		app.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if input.Visibility == "" {
+		input.Visibility = models.VisibilityPublic
+	}
+	if input.Language == "" {
+		input.Language = "none"
+	}
+
+	// Поле expires обязательно: 0 означает заметку без срока жизни, поэтому
+	// отсутствующее поле нельзя считать нулем.
+	expires := ""
+	if input.Expires != nil {
+		expires = strconv.Itoa(*input.Expires)
+	}
+
+	// Проверяем данные теми же правилами, что и HTML форму. У анонимных
+	// заметок нет автора, поэтому сделать их приватными нельзя.
+	form := forms.New(url.Values{
+		"title":      {input.Title},
+		"content":    {input.Content},
+		"expires":    {expires},
+		"visibility": {input.Visibility},
+		"language":   {input.Language},
+	})
+	form.Required("title", "content", "expires")
+	form.MaxLength("title", 100)
+	form.MaxBytes("content", maxContentBytes)
+	form.PermittedValues("expires", app.expiryOptions()...)
+	form.PermittedValues("visibility", models.VisibilityPublic, models.VisibilityUnlisted)
+	form.PermittedValues("language", snippetLanguages...)
+
+	if !form.Valid() {
+		app.apiError(w, http.StatusUnprocessableEntity, form.Errors.First())
+		return
+	}
+
+	// Заметки, созданные через API, анонимны.
+	id, err := app.snippets.Insert(r.Context(), 0, 0, form.Get("title"), form.Get("content"), form.Get("expires"), form.Get("visibility"), form.Get("language"), input.Tags)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	s, err := app.snippets.Get(r.Context(), id, 0)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", app.absoluteURL(fmt.Sprintf("/api/v1/snippets/%d", id)))
+	app.writeJSON(w, http.StatusCreated, envelope{"snippet": s})
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gzipMinSize - минимальный размер ответа в байтах, начиная с которого
+// имеет смысл его сжимать. Меньшие ответы обычно помещаются в один TCP
+// пакет и без сжатия.
+const gzipMinSize = 1400
+
+// gzipWriterPool позволяет повторно использовать gzip.Writer, так как
+// создание нового писателя требует заметного объема памяти.
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// compress сжимает ответ алгоритмом gzip, если клиент указал его в
+// заголовке Accept-Encoding. Уже сжатые форматы и ответы меньше
+// gzipMinSize отправляются как есть.
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		// Отложенный вызов выполняется и при панике в обработчике, поэтому
+		// gzip поток всегда будет завершен, а писатель возвращен в пул.
+		defer gw.close()
+
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip разбирает заголовок Accept-Encoding и проверяет, что gzip
+// указан и не запрещен значением q=0.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		weight, err := strconv.ParseFloat(q, 64)
+		return err == nil && weight > 0
+	}
+	return false
+}
+
+// incompressibleTypes - префиксы типов содержимого, которые уже сжаты.
+var incompressibleTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/pdf",
+}
+
+func compressible(contentType string) bool {
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// gzipResponseWriter накапливает начало ответа, пока не станет понятно,
+// нужно ли его сжимать: ответ должен быть не меньше gzipMinSize, иметь
+// подходящий тип содержимого и не быть уже закодированным обработчиком.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (gw *gzipResponseWriter) WriteHeader(status int) {
+	if gw.status == 0 {
+		gw.status = status
+	}
+}
+
+func (gw *gzipResponseWriter) Write(b []byte) (int, error) {
+	if gw.decided {
+		if gw.gz != nil {
+			return gw.gz.Write(b)
+		}
+		return gw.ResponseWriter.Write(b)
+	}
+
+	gw.buf = append(gw.buf, b...)
+	if len(gw.buf) >= gzipMinSize {
+		if err := gw.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// decide выбирает, сжимать ли ответ, отправляет заголовки и накопленные
+// данные.
+func (gw *gzipResponseWriter) decide() error {
+	gw.decided = true
+
+	h := gw.Header()
+	if h.Get("Content-Type") == "" && len(gw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(gw.buf))
+	}
+
+	// Частичные ответы на Range запросы не сжимаются, так как диапазон
+	// относится к несжатому содержимому.
+	if len(gw.buf) >= gzipMinSize && h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" &&
+		compressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+
+		gw.gz = gzipWriterPool.Get().(*gzip.Writer)
+		gw.gz.Reset(gw.ResponseWriter)
+	}
+
+	if gw.status == 0 {
+		gw.status = http.StatusOK
+	}
+	gw.ResponseWriter.WriteHeader(gw.status)
+
+	buf := gw.buf
+	gw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if gw.gz != nil {
+		_, err = gw.gz.Write(buf)
+	} else {
+		_, err = gw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush отправляет клиенту все данные, записанные к этому моменту.
+func (gw *gzipResponseWriter) Flush() {
+	if !gw.decided {
+		gw.decide()
+	}
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	if f, ok := gw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close завершает ответ: отправляет данные, если их набралось меньше
+// порога, и закрывает gzip поток.
+func (gw *gzipResponseWriter) close() {
+	if !gw.decided {
+		gw.decide()
+	}
+	if gw.gz != nil {
+		gw.gz.Close()
+		gw.gz.Reset(nil)
+		gzipWriterPool.Put(gw.gz)
+		gw.gz = nil
+	}
+}
+
+// Unwrap возвращает исходный http.ResponseWriter для http.ResponseController.
+func (gw *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
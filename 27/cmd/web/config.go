@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Slava02/SnippetBox/26/pkg/forms"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// config хранит все настройки веб-приложения.
+type config struct {
+	addr      string
+	dsn       string
+	baseURL   string
+	logFormat string
+	tlsCert   string
+	tlsKey    string
+	// useEmbedded включает чтение шаблонов и статических файлов из
+	// встроенной в исполняемый файл файловой системы вместо каталога ./ui.
+	useEmbedded bool
+	// debug включает отладочные маршруты /debug/pprof/ и /debug/vars.
+	debug bool
+	// replicaDSN - источник данных реплики MySQL только для чтения.
+	// Пустое значение означает, что все запросы идут в основную базу.
+	replicaDSN string
+	// dbTLS - режим TLS подключения к MySQL: false, true, skip-verify
+	// или путь к CA сертификату.
+	dbTLS string
+	// dbTimeout ограничивает время выполнения запросов к базе данных.
+	dbTimeout time.Duration
+	// Настройки пула подключений к базе данных. Значения по умолчанию
+	// совпадают со значениями по умолчанию пакета database/sql.
+	dbMaxOpenConns int
+	dbMaxIdleConns int
+	dbMaxIdleTime  time.Duration
+	// dbConnectRetries - количество попыток подключения к базе данных
+	// при запуске.
+	dbConnectRetries int
+	// cleanupInterval - период удаления заметок с истекшим сроком жизни.
+	cleanupInterval time.Duration
+	// sessionLifetime - срок действия входа без отметки "запомнить меня",
+	// rememberMeLifetime - с этой отметкой.
+	sessionLifetime    time.Duration
+	rememberMeLifetime time.Duration
+	// trailingSlash - политика для завершающего слэша в путях: strip, add
+	// или off.
+	trailingSlash string
+	// requestTimeout ограничивает время обработки запроса к страницам
+	// приложения и API.
+	requestTimeout time.Duration
+	// maxBodyBytes - максимальный размер тела POST, PUT и PATCH запросов.
+	maxBodyBytes int64
+	// homeCacheTTL - время хранения в памяти списка последних заметок
+	// для главной страницы (0 - кэш отключен).
+	homeCacheTTL time.Duration
+	// staticMaxAge - время хранения статических файлов в кэше браузера.
+	staticMaxAge time.Duration
+	// corsTrustedOrigins - источники, которым разрешены CORS запросы к API.
+	corsTrustedOrigins []string
+	// trustedProxies - подсети прокси серверов, от которых принимаются
+	// заголовки X-Forwarded-For и X-Real-IP.
+	trustedProxies []netip.Prefix
+	// maintenance включает режим обслуживания при запуске, а
+	// maintenanceSecret - секрет для его переключения через
+	// POST /admin/maintenance (пустое значение отключает этот маршрут).
+	maintenance       bool
+	maintenanceSecret string
+	// bcryptCost - стоимость bcrypt для хешей паролей.
+	bcryptCost int
+	// dedupe включает обнаружение повторно отправленных заметок.
+	dedupe bool
+	// snippetExpiryOptions - допустимые сроки жизни заметки в днях в порядке
+	// вывода в форме. 0 означает, что заметка не удаляется.
+	snippetExpiryOptions []int
+	// defaultExpiry - срок жизни заметки, выбранный в форме по умолчанию.
+	// Используется и тогда, когда срок не передан в запросе.
+	defaultExpiry int
+	// createUser - режим создания пользователя из командной строки.
+	createUser struct {
+		enabled  bool
+		name     string
+		email    string
+		password string
+	}
+	limiter struct {
+		rps     float64
+		burst   int
+		enabled bool
+	}
+}
+
+// loadConfig читает настройки из переменных окружения и флагов командной
+// строки. Флаги имеют приоритет над переменными окружения, а если не задано
+// ни то, ни другое, используются значения по умолчанию.
+func loadConfig() config {
+	var cfg config
+	cfg.snippetExpiryOptions = []int{365, 7, 1, 0}
+
+	flag.StringVar(&cfg.addr, "addr", envOr("SNIPPETBOX_ADDR", ":4000"), "Сетевой адрес веб-сервера")
+	flag.StringVar(&cfg.baseURL, "base-url", envOr("SNIPPETBOX_BASE_URL", ""), "Внешний адрес приложения для абсолютных ссылок, например https://snippets.example.com (по умолчанию http://localhost и порт из -addr)")
+	flag.StringVar(&cfg.dsn, "dsn", envOr("SNIPPETBOX_DSN", "web:pass@/snippetbox?parseTime=true"), "Название MySQL источника данных")
+	flag.StringVar(&cfg.replicaDSN, "replica-dsn", envOr("SNIPPETBOX_REPLICA_DSN", ""), "Название MySQL источника данных реплики только для чтения (по умолчанию все запросы идут в -dsn)")
+	flag.StringVar(&cfg.logFormat, "log-format", "text", "Формат логов: text или json")
+	flag.StringVar(&cfg.tlsCert, "tls-cert", "", "Путь к файлу TLS сертификата")
+	flag.StringVar(&cfg.tlsKey, "tls-key", "", "Путь к файлу закрытого ключа TLS")
+	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Максимальное количество запросов в секунду с одного IP")
+	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Максимальный всплеск запросов с одного IP")
+	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Включить ограничение частоты запросов")
+	flag.DurationVar(&cfg.dbTimeout, "db-timeout", 5*time.Second, "Максимальное время выполнения запроса к базе данных")
+	flag.IntVar(&cfg.dbMaxOpenConns, "db-max-open-conns", 0, "Максимальное количество открытых подключений к базе данных (0 - без ограничений)")
+	flag.IntVar(&cfg.dbMaxIdleConns, "db-max-idle-conns", 2, "Максимальное количество простаивающих подключений к базе данных")
+	flag.DurationVar(&cfg.dbMaxIdleTime, "db-max-idle-time", 0, "Максимальное время простоя подключения к базе данных, например 15m (0 - без ограничений)")
+	flag.DurationVar(&cfg.cleanupInterval, "cleanup-interval", time.Hour, "Период удаления истекших анонимных заметок")
+	flag.DurationVar(&cfg.homeCacheTTL, "home-cache-ttl", 5*time.Second, "Время кэширования списка заметок на главной странице (0 - без кэша)")
+	flag.DurationVar(&cfg.staticMaxAge, "static-max-age", time.Hour, "Время хранения статических файлов в кэше браузера (0 - без заголовков кэширования)")
+	flag.BoolVar(&cfg.useEmbedded, "use-embedded", true, "Использовать встроенные в исполняемый файл шаблоны и статические файлы (false - читать из ./ui)")
+	flag.BoolVar(&cfg.debug, "debug", false, "Включить отладочные маршруты /debug/pprof/ и /debug/vars")
+	flag.StringVar(&cfg.dbTLS, "db-tls", envOr("SNIPPETBOX_DB_TLS", "false"), "TLS подключение к MySQL: false, true, skip-verify или путь к PEM файлу CA сертификата")
+	flag.IntVar(&cfg.dbConnectRetries, "db-connect-retries", 5, "Количество попыток подключения к базе данных при запуске")
+	flag.StringVar(&cfg.trailingSlash, "trailing-slash", "strip", "Завершающий слэш в путях: strip - убирать, add - добавлять, off - не перенаправлять")
+	flag.DurationVar(&cfg.requestTimeout, "request-timeout", 15*time.Second, "Максимальное время обработки запроса, после которого возвращается ответ 503")
+	flag.Int64Var(&cfg.maxBodyBytes, "max-body-bytes", 1<<20, "Максимальный размер тела запроса в байтах")
+	flag.BoolVar(&cfg.createUser.enabled, "create-user", false, "Создать пользователя и завершить работу, не запуская сервер")
+	flag.StringVar(&cfg.createUser.name, "user-name", "", "Имя создаваемого пользователя (для -create-user)")
+	flag.StringVar(&cfg.createUser.email, "user-email", "", "Email создаваемого пользователя (для -create-user)")
+	flag.StringVar(&cfg.createUser.password, "user-password", "", "Пароль создаваемого пользователя (для -create-user)")
+	flag.Func("cors-trusted-origins", "Доверенные CORS источники для API, через пробел", func(val string) error {
+		cfg.corsTrustedOrigins = strings.Fields(val)
+		return nil
+	})
+	flag.BoolVar(&cfg.maintenance, "maintenance", false, "Запустить приложение в режиме обслуживания: все страницы возвращают 503")
+	flag.StringVar(&cfg.maintenanceSecret, "maintenance-secret", envOr("SNIPPETBOX_MAINTENANCE_SECRET", ""), "Секрет для переключения режима обслуживания через POST /admin/maintenance")
+	flag.IntVar(&cfg.bcryptCost, "bcrypt-cost", 12, "Стоимость bcrypt для хешей паролей; хеши с меньшей стоимостью пересоздаются при входе")
+	flag.BoolVar(&cfg.dedupe, "dedupe", true, "Не создавать повторно заметку с тем же заголовком и содержимым, если у автора уже есть такая")
+	flag.Func("snippet-expiry-options", "Допустимые сроки жизни заметки в днях через запятую, 0 - без срока (по умолчанию 365,7,1,0)", func(val string) error {
+		var options []int
+		for _, part := range strings.Split(val, ",") {
+			days, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return fmt.Errorf("некорректный срок жизни %q", part)
+			}
+			options = append(options, days)
+		}
+		cfg.snippetExpiryOptions = options
+		return nil
+	})
+	flag.IntVar(&cfg.defaultExpiry, "default-expiry", -1, "Срок жизни заметки в днях, выбранный по умолчанию; должен входить в -snippet-expiry-options (по умолчанию первый из них)")
+	flag.Func("trusted-proxies", "Подсети доверенных прокси в формате CIDR через запятую или пробел; только от них принимаются X-Forwarded-For и X-Real-IP", func(val string) error {
+		var prefixes []netip.Prefix
+		for _, s := range strings.FieldsFunc(val, func(r rune) bool { return r == ',' || r == ' ' }) {
+			// Отдельный адрес без маски считается подсетью из одного адреса.
+			prefix, err := netip.ParsePrefix(s)
+			if err != nil {
+				addr, addrErr := netip.ParseAddr(s)
+				if addrErr != nil {
+					return fmt.Errorf("некорректная подсеть %q", s)
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			prefixes = append(prefixes, prefix.Masked())
+		}
+		cfg.trustedProxies = prefixes
+		return nil
+	})
+	flag.DurationVar(&cfg.sessionLifetime, "session-lifetime", 12*time.Hour, "Срок действия входа без отметки \"запомнить меня\"")
+	flag.DurationVar(&cfg.rememberMeLifetime, "remember-me-lifetime", 30*24*time.Hour, "Срок действия входа с отметкой \"запомнить меня\"")
+	flag.Parse()
+
+	if cfg.baseURL == "" {
+		cfg.baseURL = "http://localhost"
+		if _, port, err := net.SplitHostPort(cfg.addr); err == nil && port != "" {
+			cfg.baseURL += ":" + port
+		}
+	}
+
+	if cfg.defaultExpiry == -1 && len(cfg.snippetExpiryOptions) > 0 {
+		cfg.defaultExpiry = cfg.snippetExpiryOptions[0]
+	}
+
+	return cfg
+}
+
+// validate проверяет, что значения настроек согласованы между собой.
+func (cfg config) validate() error {
+	if (cfg.tlsCert == "") != (cfg.tlsKey == "") {
+		return errors.New("флаги -tls-cert и -tls-key должны быть заданы вместе")
+	}
+	if cfg.limiter.enabled && (cfg.limiter.rps <= 0 || cfg.limiter.burst < 1) {
+		return errors.New("флаг -limiter-rps должен быть больше 0, а -limiter-burst не меньше 1")
+	}
+	if cfg.cleanupInterval <= 0 {
+		return errors.New("флаг -cleanup-interval должен быть больше 0")
+	}
+	if cfg.dbConnectRetries < 1 {
+		return errors.New("флаг -db-connect-retries должен быть не меньше 1")
+	}
+	if cfg.sessionLifetime <= 0 || cfg.rememberMeLifetime < cfg.sessionLifetime {
+		return errors.New("флаг -session-lifetime должен быть больше 0, а -remember-me-lifetime не меньше него")
+	}
+	if cfg.bcryptCost < bcrypt.MinCost || cfg.bcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("флаг -bcrypt-cost должен быть от %d до %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	switch cfg.trailingSlash {
+	case "strip", "add", "off":
+	default:
+		return errors.New("флаг -trailing-slash должен быть strip, add или off")
+	}
+	if cfg.requestTimeout <= 0 {
+		return errors.New("флаг -request-timeout должен быть больше 0")
+	}
+	if cfg.maxBodyBytes < 1 {
+		return errors.New("флаг -max-body-bytes должен быть больше 0")
+	}
+	if cfg.createUser.enabled {
+		if cfg.createUser.name == "" || cfg.createUser.email == "" || cfg.createUser.password == "" {
+			return errors.New("для -create-user нужно задать -user-name, -user-email и -user-password")
+		}
+		if !forms.EmailRX.MatchString(cfg.createUser.email) {
+			return errors.New("флаг -user-email содержит некорректный email адрес")
+		}
+		if utf8.RuneCountInString(cfg.createUser.password) < 8 {
+			return errors.New("флаг -user-password должен содержать не меньше 8 символов")
+		}
+		if len(cfg.createUser.password) > maxPasswordBytes {
+			return fmt.Errorf("флаг -user-password должен занимать не больше %d байт", maxPasswordBytes)
+		}
+	}
+	if u, err := url.Parse(cfg.baseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("флаг -base-url должен быть абсолютным http или https адресом")
+	}
+	if cfg.homeCacheTTL < 0 {
+		return errors.New("флаг -home-cache-ttl не может быть отрицательным")
+	}
+	if cfg.staticMaxAge < 0 {
+		return errors.New("флаг -static-max-age не может быть отрицательным")
+	}
+	if len(cfg.snippetExpiryOptions) == 0 {
+		return errors.New("флаг -snippet-expiry-options должен содержать хотя бы один срок")
+	}
+	seen := make(map[int]bool)
+	for _, days := range cfg.snippetExpiryOptions {
+		if days < 0 || seen[days] {
+			return errors.New("флаг -snippet-expiry-options должен содержать неотрицательные сроки без повторов")
+		}
+		seen[days] = true
+	}
+	if !seen[cfg.defaultExpiry] {
+		return errors.New("флаг -default-expiry должен быть одним из сроков -snippet-expiry-options")
+	}
+	return nil
+}
+
+// useTLS возвращает true, если сервер должен работать по HTTPS.
+func (cfg config) useTLS() bool {
+	return cfg.tlsCert != "" && cfg.tlsKey != ""
+}
+
+// envOr возвращает значение переменной окружения key или fallback,
+// если переменная не задана или пуста.
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
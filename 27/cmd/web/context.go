@@ -0,0 +1,17 @@
+package main
+
+// contextKey - собственный тип для ключей контекста запроса, чтобы
+// избежать пересечений с ключами других пакетов.
+type contextKey string
+
+// authenticatedUserContextKey - ключ, по которому в контексте запроса
+// хранится *models.User текущего пользователя.
+const authenticatedUserContextKey = contextKey("authenticatedUser")
+
+// requestIDContextKey - ключ, по которому в контексте запроса хранится
+// идентификатор запроса.
+const requestIDContextKey = contextKey("requestID")
+
+// nonceContextKey - ключ, по которому в контексте запроса хранится nonce
+// для встроенных скриптов из заголовка Content-Security-Policy.
+const nonceContextKey = contextKey("nonce")
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/Slava02/SnippetBox/26/pkg/models"
+)
+
+// maxDiffCells ограничивает размер таблицы, которую строит lineDiff. Для
+// больших текстов вместо построчного сравнения старая версия целиком
+// показывается как удаленная, а новая - как добавленная.
+const maxDiffCells = 1 << 20
+
+// diffLine - строка построчного сравнения двух версий заметки. Op равен
+// "+" для добавленной строки, "-" для удаленной и " " для неизменной.
+type diffLine struct {
+	Op   string
+	Text string
+}
+
+// revisionDiff - версия заметки вместе с отличиями следующей за ней версии.
+type revisionDiff struct {
+	Revision *models.Revision
+	Lines    []diffLine
+}
+
+// lineDiff сравнивает тексты old и new построчно с помощью наибольшей общей
+// подпоследовательности строк.
+func lineDiff(old, new string) []diffLine {
+	a := splitLines(old)
+	b := splitLines(new)
+
+	if len(a)*len(b) > maxDiffCells {
+		lines := make([]diffLine, 0, len(a)+len(b))
+		for _, line := range a {
+			lines = append(lines, diffLine{Op: "-", Text: line})
+		}
+		for _, line := range b {
+			lines = append(lines, diffLine{Op: "+", Text: line})
+		}
+		return lines
+	}
+
+	// lcs[i][j] - длина общей подпоследовательности a[i:] и b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{Op: " ", Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{Op: "-", Text: a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{Op: "+", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{Op: "-", Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{Op: "+", Text: b[j]})
+	}
+	return lines
+}
+
+// splitLines разбивает текст на строки без завершающих символов перевода
+// строки. Для пустого текста возвращается пустой срез.
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// emailSender отправляет письма пользователям.
+type emailSender interface {
+	Send(to, subject, body string) error
+}
+
+// logEmailSender - заглушка, которая вместо отправки письма записывает
+// его в лог. Подходит для разработки, пока не настроен SMTP сервер.
+type logEmailSender struct {
+	infoLog *log.Logger
+}
+
+func (s *logEmailSender) Send(to, subject, body string) error {
+	s.infoLog.Printf("Письмо для %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+// sendActivationEmail отправляет пользователю ссылку для активации аккаунта.
+func (app *application) sendActivationEmail(name, email, link string) error {
+	body := fmt.Sprintf("Здравствуйте, %s!\n\nЧтобы активировать аккаунт, перейдите по ссылке:\n%s\n\nСсылка действительна %d часа.",
+		name, link, int(activationTokenTTL.Hours()))
+	return app.emails.Send(email, "Активация аккаунта Snippetbox", body)
+}
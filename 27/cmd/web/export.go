@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Slava02/SnippetBox/26/pkg/forms"
+	"github.com/Slava02/SnippetBox/26/pkg/models"
+)
+
+// bundleSnippet - заметка в файле выгрузки. Expires - срок жизни в днях
+// из -snippet-expiry-options, поэтому выгруженный файл можно сразу
+// загрузить обратно.
+type bundleSnippet struct {
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	Expires    *int     `json:"expires"`
+	Visibility string   `json:"visibility"`
+	Language   string   `json:"language"`
+	Tags       []string `json:"tags"`
+}
+
+// exportWriteTimeout - срок записи ответа с выгрузкой заметок.
+const exportWriteTimeout = 5 * time.Minute
+
+// importError описывает заметку из загруженного файла, которую не удалось
+// импортировать. Index - номер заметки в файле, начиная с 1.
+type importError struct {
+	Index   int
+	Title   string
+	Message string
+}
+
+// accountExport отдает все актуальные заметки текущего пользователя в виде
+// JSON массива для сохранения в файл. AllByUser() загружает заметки из
+// базы сразу, но клиенту они отправляются по одной через json.Encoder,
+// без сборки всего файла в памяти. Маршрут исключен из app.timeout, так
+// как http.TimeoutHandler буферизует весь ответ, а срок записи ответа
+// продлевается до exportWriteTimeout.
+func (app *application) accountExport(w http.ResponseWriter, r *http.Request) {
+	userID := app.session.GetInt(r.Context(), "authenticatedUserID")
+
+	snippets, err := app.snippets.AllByUser(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// WriteTimeout сервера рассчитан на обычные запросы, поэтому для
+	// выгрузки срок записи ответа продлевается.
+	err = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=snippets.json")
+
+	// Каждая заметка записывается отдельной строкой, а запятая ставится в
+	// начале следующей, так как Encode() завершает значение переводом
+	// строки. После начала ответа сообщить об ошибке уже нельзя, поэтому
+	// при ошибке записи выгрузка просто прерывается.
+	enc := json.NewEncoder(w)
+	io.WriteString(w, "[\n")
+	for i, s := range snippets {
+		expires := app.expiryOptionFor(s.Expires)
+		entry := bundleSnippet{
+			Title:      s.Title,
+			Content:    s.Content,
+			Expires:    &expires,
+			Visibility: s.Visibility,
+			Language:   s.Language,
+			Tags:       s.Tags,
+		}
+		if entry.Tags == nil {
+			entry.Tags = []string{}
+		}
+
+		if i > 0 {
+			io.WriteString(w, ",")
+		}
+		err = enc.Encode(entry)
+		if err != nil {
+			return
+		}
+	}
+	io.WriteString(w, "]\n")
+}
+
+// expiryOptionFor подбирает для заметки со сроком жизни expires значение
+// из -snippet-expiry-options: наименьший срок, не меньший оставшегося, а
+// если такого нет - наибольший. Для заметок без срока жизни выбирается 0,
+// если он разрешен.
+func (app *application) expiryOptionFor(expires time.Time) int {
+	options := app.config.snippetExpiryOptions
+
+	remaining := 0
+	if !expires.IsZero() {
+		remaining = int((time.Until(expires) + 24*time.Hour - 1) / (24 * time.Hour))
+	}
+
+	best, largest := -1, -1
+	for _, days := range options {
+		if days == 0 {
+			if expires.IsZero() {
+				return 0
+			}
+			continue
+		}
+		if days > largest {
+			largest = days
+		}
+		if !expires.IsZero() && days >= remaining && (best == -1 || days < best) {
+			best = days
+		}
+	}
+
+	switch {
+	case best != -1:
+		return best
+	case largest != -1:
+		return largest
+	default:
+		return 0
+	}
+}
+
+// accountImport создает заметки из загруженного файла выгрузки. Каждая
+// заметка проверяется теми же правилами, что и форма создания заметки.
+// Корректные заметки сохраняются в одной транзакции, а о некорректных
+// пользователь получает отчет.
+func (app *application) accountImport(w http.ResponseWriter, r *http.Request) {
+	// Размер тела запроса уже ограничен limitRequestBody, а multipart форму
+	// разбирает nosurf при проверке CSRF токена.
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.bodyTooLarge(w, r)
+			return
+		}
+		app.renderImport(w, r, http.StatusUnprocessableEntity, 0, nil, "Выберите файл для загрузки")
+		return
+	}
+	defer file.Close()
+
+	// r.FormFile() уже разобрал тело запроса целиком, поэтому файл лежит в
+	// памяти или во временном файле, а его размер ограничен только
+	// limitRequestBody. Заметки декодируются из него по одной, но
+	// корректные накапливаются в valid до общей вставки.
+	dec := json.NewDecoder(file)
+	dec.DisallowUnknownFields()
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		app.renderImport(w, r, http.StatusUnprocessableEntity, 0, nil, "Файл должен содержать JSON массив заметок")
+		return
+	}
+
+	var valid []models.NewSnippet
+	var failed []importError
+
+	for index := 1; dec.More(); index++ {
+		var entry bundleSnippet
+		err := dec.Decode(&entry)
+		if err != nil {
+			// Синтаксическая ошибка не позволяет продолжить чтение файла,
+			// а ошибки типов и неизвестные поля относятся только к
+			// текущей заметке.
+			var syntaxError *json.SyntaxError
+			if errors.As(err, &syntaxError) || errors.Is(err, io.ErrUnexpectedEOF) {
+				app.renderImport(w, r, http.StatusUnprocessableEntity, 0, nil, fmt.Sprintf("Некорректный JSON в заметке %d", index))
+				return
+			}
+			failed = append(failed, importError{Index: index, Message: "Некорректная заметка"})
+			continue
+		}
+
+		form := app.importForm(entry)
+		if !form.Valid() {
+			var messages []string
+			for field, message := range form.Errors.First() {
+				messages = append(messages, field+": "+message)
+			}
+			sort.Strings(messages)
+			failed = append(failed, importError{Index: index, Title: entry.Title, Message: strings.Join(messages, "; ")})
+			continue
+		}
+
+		valid = append(valid, models.NewSnippet{
+			Title:      form.Get("title"),
+			Content:    form.Get("content"),
+			Expires:    form.Get("expires"),
+			Visibility: form.Get("visibility"),
+			Language:   form.Get("language"),
+			Tags:       entry.Tags,
+		})
+	}
+
+	if _, err := dec.Token(); err != nil {
+		app.renderImport(w, r, http.StatusUnprocessableEntity, 0, nil, "Файл должен содержать JSON массив заметок")
+		return
+	}
+
+	if len(valid) > 0 {
+		userID := app.session.GetInt(r.Context(), "authenticatedUserID")
+		err = app.snippets.InsertBatch(r.Context(), userID, valid)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	app.renderImport(w, r, http.StatusOK, len(valid), failed, "")
+}
+
+// importForm проверяет заметку из файла выгрузки. Отсутствующие видимость
+// и язык заменяются значениями по умолчанию, как в API.
+func (app *application) importForm(entry bundleSnippet) *forms.Form {
+	if entry.Visibility == "" {
+		entry.Visibility = models.VisibilityPublic
+	}
+	if entry.Language == "" {
+		entry.Language = "none"
+	}
+
+	expires := ""
+	if entry.Expires != nil {
+		expires = strconv.Itoa(*entry.Expires)
+	}
+
+	form := forms.New(url.Values{
+		"title":      {entry.Title},
+		"content":    {entry.Content},
+		"expires":    {expires},
+		"visibility": {entry.Visibility},
+		"language":   {entry.Language},
+	})
+	form.Required("title", "content", "expires")
+	form.MaxLength("title", 100)
+	form.MaxBytes("content", maxContentBytes)
+	form.PermittedValues("expires", app.expiryOptions()...)
+	form.PermittedValues("visibility", models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate)
+	form.PermittedValues("language", snippetLanguages...)
+
+	for _, tag := range entry.Tags {
+		if utf8.RuneCountInString(tag) > 50 {
+			form.Errors.Add("tags", "Тег слишком длинный (максимум 50 символов)")
+			break
+		}
+	}
+
+	return form
+}
+
+// renderImport отображает результат импорта заметок или ошибку загрузки
+// файла fileError.
+func (app *application) renderImport(w http.ResponseWriter, r *http.Request, status, imported int, failed []importError, fileError string) {
+	form := forms.New(nil)
+	if fileError != "" {
+		form.Errors.Add("file", fileError)
+	}
+
+	app.render(w, r, status, "import.page.tmpl", &templateData{
+		Form:          form,
+		ImportedCount: imported,
+		ImportErrors:  failed,
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// atomFeed и atomEntry описывают документ Atom 1.0 (RFC 4287). Текстовые
+// поля экранируются пакетом encoding/xml, поэтому специальные символы в
+// заголовках заметок не нарушают разметку.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+}
+
+// feedAtom отдает последние публичные заметки в виде Atom ленты.
+func (app *application) feedAtom(w http.ResponseWriter, r *http.Request) {
+	s, err := app.snippets.Latest(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Время обновления ленты - время создания самой новой заметки, а для
+	// пустой ленты - текущее время.
+	updated := time.Now()
+	if len(s) > 0 {
+		updated = s[0].Created
+	}
+
+	feed := atomFeed{
+		ID:      app.absoluteURL("/"),
+		Title:   "Snippetbox",
+		Updated: updated.UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: "Snippetbox"},
+		Links: []atomLink{
+			{Href: app.absoluteURL("/feed.atom"), Rel: "self"},
+			{Href: app.absoluteURL("/")},
+		},
+	}
+	for _, snippet := range s {
+		link := app.absoluteURL(fmt.Sprintf("/snippet/view/%d", snippet.ID))
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      link,
+			Title:   snippet.Title,
+			Updated: snippet.Created.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: link},
+		})
+	}
+
+	// Пишем документ в буфер, чтобы при ошибке сериализации вернуть
+	// ответ 500, а не обрезанный XML.
+	buf := new(bytes.Buffer)
+	buf.WriteString(xml.Header)
+	err = xml.NewEncoder(buf).Encode(feed)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	buf.WriteTo(w)
+}
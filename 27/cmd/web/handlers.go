@@ -1,75 +1,791 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
+	"github.com/Slava02/SnippetBox/26/pkg/forms"
 	"github.com/Slava02/SnippetBox/26/pkg/models"
+	"github.com/julienschmidt/httprouter"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
+// snippetsPerPage - количество заметок на одной странице главной страницы.
+const snippetsPerPage = 10
+
+// activationTokenTTL - срок действия ссылки для активации аккаунта.
+const activationTokenTTL = 72 * time.Hour
+
+// maxPasswordBytes - максимальная длина пароля в байтах. bcrypt не
+// принимает пароли длиннее и возвращает bcrypt.ErrPasswordTooLong.
+const maxPasswordBytes = 72
+
+// maxContentBytes - максимальный размер содержимого заметки в байтах.
+// Столбец snippets.content имеет тип TEXT, и более длинное значение MySQL
+// отклоняет ошибкой.
+const maxContentBytes = 65535
+
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/" {
-		app.notFound(w)
+	total, err := app.snippets.Count(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
+	totalPages := (total + snippetsPerPage - 1) / snippetsPerPage
 
-	s, err := app.snippets.Latest()
+	// Номер страницы берется из параметра page. Отсутствующие, нечисловые
+	// и отрицательные значения приводятся к первой странице, а слишком
+	// большие - к последней, чтобы смещение в запросе не переполнилось.
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	if page > totalPages {
+		page = max(totalPages, 1)
+	}
+
+	s, err := app.snippets.LatestPaged(r.Context(), snippetsPerPage, (page-1)*snippetsPerPage)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
 	// Используем помощника render() для отображения шаблона.
-	app.render(w, r, "home.page.tmpl", &templateData{
-		Snippets: s,
+	app.render(w, r, http.StatusOK, "home.page.tmpl", &templateData{
+		CurrentPage: page,
+		TotalPages:  totalPages,
+		Snippets:    s,
 	})
 }
 
 func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.Atoi(r.URL.Query().Get("id"))
-	if err != nil || id < 1 {
-		fmt.Printf("snippetView notFound id=%d\n", id)
-		app.notFound(w)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w, r)
 		return
 	}
 
-	s, err := app.snippets.Get(id)
+	// Приватные заметки доступны только автору, поэтому передаем ID
+	// текущего пользователя (0 для анонимных посетителей).
+	userID := app.session.GetInt(r.Context(), "authenticatedUserID")
+
+	s, err := app.snippets.Get(r.Context(), id, userID)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			app.notFound(w)
+			app.notFound(w, r)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
 
+	// Счетчик просмотров увеличивается в фоне, чтобы не задерживать ответ.
+	// Контекст запроса отменяется после ответа, поэтому используется
+	// собственный контекст. Ошибки только записываются в лог.
+	requestID := app.requestID(r)
+	app.background(func() {
+		err := app.snippets.IncrementViews(context.Background(), id)
+		if err != nil {
+			app.errorLog.Printf("[%s] увеличение счетчика просмотров заметки %d: %v", requestID, id, err)
+		}
+	})
+
+	// Если у клиента уже есть актуальная версия страницы, отвечаем 304 Not
+	// Modified без тела. Когда в сессии ждет flash сообщение, страницу нужно
+	// отрисовать заново, иначе сообщение не будет показано.
+	etag := snippetETag(s, userID)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	status := http.StatusOK
+	if etagMatches(r.Header.Get("If-None-Match"), etag) && !app.session.Exists(r.Context(), "flash") {
+		status = http.StatusNotModified
+	}
+
 	// Используем помощника render() для отображения шаблона.
-	app.render(w, r, "show.page.tmpl", &templateData{
-		Snippet: s,
+	app.render(w, r, status, "show.page.tmpl", &templateData{
+		Snippet:       s,
+		Highlighted:   highlight(s.Content, s.Language),
+		SizeBytes:     len(s.Content),
+		LineCount:     countLines(s.Content),
+		ExpiryOptions: app.expiryOptions(),
 	})
 }
 
-func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.Header().Set("Allow", http.MethodPost)
-		app.clientError(w, http.StatusMethodNotAllowed)
+// snippetViewRaw отдает содержимое заметки обычным текстом без HTML
+// оформления, например для загрузки через curl.
+func (app *application) snippetViewRaw(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	userID := app.session.GetInt(r.Context(), "authenticatedUserID")
+
+	s, err := app.snippets.Get(r.Context(), id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Содержимое отправляется как есть, без экранирования. Тип text/plain
+	// вместе с заголовком X-Content-Type-Options: nosniff не позволяет
+	// браузеру интерпретировать его как HTML.
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", "inline")
+	w.Write([]byte(s.Content))
+}
+
+// snippetHistory отображает предыдущие версии заметки и их отличия от
+// следующих за ними версий. История доступна только автору заметки.
+func (app *application) snippetHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	s, ok := app.ownedSnippet(w, r, id)
+	if !ok {
 		return
 	}
 
-	// Создаем несколько переменных, содержащих тестовые данные. Мы удалим их позже.
-	title := "История про улитку"
-	content := "Улитка выползла из раковины,\nвытянула рожки,\nи опять подобрала их."
-	expires := "7"
+	revisions, err := app.snippets.Revisions(r.Context(), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Версии идут от новых к старым, поэтому самая новая сравнивается с
+	// текущим содержимым заметки, а каждая следующая - с предыдущей в
+	// списке.
+	diffs := make([]revisionDiff, len(revisions))
+	next := s.Content
+	for i, rev := range revisions {
+		diffs[i] = revisionDiff{Revision: rev, Lines: lineDiff(rev.Content, next)}
+		next = rev.Content
+	}
+
+	app.render(w, r, http.StatusOK, "history.page.tmpl", &templateData{
+		Snippet:   s,
+		Revisions: diffs,
+	})
+}
+
+// snippetCreateForm отображает форму создания новой заметки.
+func (app *application) snippetCreateForm(w http.ResponseWriter, r *http.Request) {
+	app.render(w, r, http.StatusOK, "create.page.tmpl", &templateData{
+		Form: forms.New(url.Values{
+			"expires":    {app.defaultExpiry()},
+			"visibility": {models.VisibilityPublic},
+			"language":   {"none"},
+		}),
+		Languages:     snippetLanguages,
+		ExpiryOptions: app.expiryOptions(),
+	})
+}
+
+// snippetFork отображает форму создания заметки, заполненную данными
+// существующей заметки. Новая заметка создается только после отправки
+// формы и ссылается на исходную через скрытое поле forked_from.
+func (app *application) snippetFork(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	userID := app.session.GetInt(r.Context(), "authenticatedUserID")
+
+	s, err := app.snippets.Get(r.Context(), id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Заголовок копии обрезается до допустимой длины, чтобы форму можно
+	// было отправить без исправлений.
+	title := []rune("Копия: " + s.Title)
+	if len(title) > 100 {
+		title = title[:100]
+	}
+
+	app.render(w, r, http.StatusOK, "create.page.tmpl", &templateData{
+		Form: forms.New(url.Values{
+			"title":       {string(title)},
+			"content":     {s.Content},
+			"tags":        {strings.Join(s.Tags, ", ")},
+			"expires":     {app.defaultExpiry()},
+			"visibility":  {models.VisibilityPublic},
+			"language":    {s.Language},
+			"forked_from": {strconv.Itoa(s.ID)},
+		}),
+		Languages:     snippetLanguages,
+		ExpiryOptions: app.expiryOptions(),
+	})
+}
+
+func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
+	// Содержимое заметки можно вставить в текстовое поле или загрузить
+	// файлом. Во втором случае форма отправляется как multipart/form-data.
+	var form *forms.Form
+	if isMultipart(r) {
+		var ok bool
+		form, ok = app.parseSnippetUpload(w, r)
+		if !ok {
+			return
+		}
+	} else {
+		if !app.parseForm(w, r) {
+			return
+		}
+		form = forms.New(r.PostForm)
+	}
+
+	// Если срок жизни не выбран, например при отправке формы скриптом,
+	// используется срок по умолчанию из -default-expiry.
+	if strings.TrimSpace(form.Get("expires")) == "" {
+		form.Set("expires", app.defaultExpiry())
+	}
+
+	// Проверяем данные формы. Если есть ошибки, повторно отображаем форму,
+	// сохраняя введенные пользователем значения.
+	form.Required("title", "content", "expires", "visibility", "language")
+	form.MaxLength("title", 100)
+	form.MinLength("content", 1)
+	form.MaxBytes("content", maxContentBytes)
+	form.PermittedValues("expires", app.expiryOptions()...)
+	form.PermittedValues("visibility", models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate)
+	form.PermittedValues("language", snippetLanguages...)
+
+	// Теги вводятся через запятую, каждый не длиннее 50 символов.
+	tags := splitTags(form.Get("tags"))
+	for _, tag := range tags {
+		if utf8.RuneCountInString(tag) > 50 {
+			form.Errors.Add("tags", "Тег слишком длинный (максимум 50 символов)")
+			break
+		}
+	}
+
+	// Для копии заметки запоминаем исходную, если она все еще доступна
+	// пользователю. Если исходная заметка успела истечь или была удалена,
+	// копия создается без ссылки на неё.
+	userID := app.session.GetInt(r.Context(), "authenticatedUserID")
+	forkedFrom := 0
+	if v := form.Get("forked_from"); v != "" {
+		sourceID, err := strconv.Atoi(v)
+		if err != nil || sourceID < 1 {
+			form.Errors.Add("forked_from", "Некорректная исходная заметка")
+		} else if _, err := app.snippets.Get(r.Context(), sourceID, userID); err == nil {
+			forkedFrom = sourceID
+		} else if !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		app.render(w, r, http.StatusUnprocessableEntity, "create.page.tmpl", &templateData{
+			Form:          form,
+			Languages:     snippetLanguages,
+			ExpiryOptions: app.expiryOptions(),
+		})
+		return
+	}
 
 	// Передаем данные в метод SnippetModel.Insert(), получая обратно
-	// ID только что созданной записи в базу данных.
-	id, err := app.snippets.Insert(title, content, expires)
+	// ID только что созданной записи в базу данных. Автором заметки
+	// становится текущий пользователь.
+	id, err := app.snippets.Insert(r.Context(), userID, forkedFrom, form.Get("title"), form.Get("content"), form.Get("expires"), form.Get("visibility"), form.Get("language"), tags)
 	if err != nil {
-		app.serverError(w, err)
+		// Такая заметка уже есть, например после двойного нажатия на
+		// кнопку отправки. Перенаправляем пользователя на неё.
+		if errors.Is(err, models.ErrDuplicateSnippet) {
+			app.session.Put(r.Context(), "flash", "Такая заметка уже существует.")
+			http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+			return
+		}
+		app.serverError(w, r, err)
 		return
 	}
 
+	// Сохраняем в сессии flash сообщение, которое будет показано
+	// пользователю на следующей странице.
+	app.session.Put(r.Context(), "flash", "Заметка успешно создана!")
+
 	// Перенаправляем пользователя на соответствующую страницу заметки.
-	http.Redirect(w, r, fmt.Sprintf("/snippet?id=%d", id), http.StatusSeeOther)
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+// snippetEdit отображает форму редактирования существующей заметки.
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	s, ok := app.ownedSnippet(w, r, id)
+	if !ok {
+		return
+	}
+
+	// Заполняем форму текущими значениями заметки.
+	app.render(w, r, http.StatusOK, "create.page.tmpl", &templateData{
+		Form: forms.New(url.Values{
+			"title":   {s.Title},
+			"content": {s.Content},
+		}),
+		Snippet:       s,
+		ExpiryOptions: app.expiryOptions(),
+	})
+}
+
+// snippetEditPost обрабатывает отправку формы редактирования заметки.
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	if _, ok := app.ownedSnippet(w, r, id); !ok {
+		return
+	}
+
+	if !app.parseForm(w, r) {
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("title", "content", "expires")
+	form.MaxLength("title", 100)
+	form.MinLength("content", 1)
+	form.MaxBytes("content", maxContentBytes)
+	form.PermittedValues("expires", app.expiryOptions()...)
+
+	// Если есть ошибки, повторно отображаем форму создания заметки,
+	// передавая ошибки и ранее введенные данные.
+	if !form.Valid() {
+		app.render(w, r, http.StatusUnprocessableEntity, "create.page.tmpl", &templateData{
+			Form:          form,
+			Snippet:       &models.Snippet{ID: id},
+			ExpiryOptions: app.expiryOptions(),
+		})
+		return
+	}
+
+	// Значение уже проверено через PermittedValues, поэтому ошибки быть не может.
+	days, _ := strconv.Atoi(form.Get("expires"))
+
+	err = app.snippets.Update(r.Context(), id, form.Get("title"), form.Get("content"), days)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.session.Put(r.Context(), "flash", "Заметка успешно обновлена!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+// snippetDelete удаляет заметку и перенаправляет пользователя на главную страницу.
+func (app *application) snippetDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	if _, ok := app.ownedSnippet(w, r, id); !ok {
+		return
+	}
+
+	err = app.snippets.Delete(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.session.Put(r.Context(), "flash", "Заметка удалена.")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// snippetExtend продлевает срок жизни заметки на выбранное автором
+// количество дней и возвращает его на страницу заметки.
+func (app *application) snippetExtend(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	if !app.parseForm(w, r) {
+		return
+	}
+
+	// Срок выбирается из списка на странице заметки, поэтому другое
+	// значение может прийти только в поддельном запросе.
+	form := forms.New(r.PostForm)
+	form.Required("expires")
+	form.PermittedValues("expires", app.expiryOptions()...)
+	if !form.Valid() {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	// Значение уже проверено через PermittedValues, поэтому ошибки быть не может.
+	days, _ := strconv.Atoi(form.Get("expires"))
+	userID := app.session.GetInt(r.Context(), "authenticatedUserID")
+
+	err = app.snippets.Extend(r.Context(), id, userID, days)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			app.notFound(w, r)
+		case errors.Is(err, models.ErrForbidden):
+			app.clientError(w, r, http.StatusForbidden)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.session.Put(r.Context(), "flash", "Срок жизни заметки продлен.")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+// snippetsByTag отображает актуальные заметки с указанным тегом.
+func (app *application) snippetsByTag(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	tag := params.ByName("name")
+
+	s, err := app.snippets.GetByTag(r.Context(), tag)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, http.StatusOK, "home.page.tmpl", &templateData{
+		Tag:      tag,
+		Snippets: s,
+	})
+}
+
+// maxSearchQueryLength - максимальная длина поискового запроса в символах.
+const maxSearchQueryLength = 100
+
+// snippetSearch выполняет полнотекстовый поиск заметок по параметру q.
+func (app *application) snippetSearch(w http.ResponseWriter, r *http.Request) {
+	// Обрезаем пробелы и слишком длинные запросы.
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if utf8.RuneCountInString(q) > maxSearchQueryLength {
+		q = string([]rune(q)[:maxSearchQueryLength])
+	}
+
+	td := &templateData{IsSearch: true, SearchQuery: q}
+
+	// Пустой запрос не отправляем в базу данных, шаблон покажет
+	// сообщение об отсутствии результатов.
+	if q != "" {
+		s, err := app.snippets.Search(r.Context(), q)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		td.Snippets = s
+	}
+
+	app.render(w, r, http.StatusOK, "home.page.tmpl", td)
+}
+
+// userSignup отображает форму регистрации пользователя.
+func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
+	app.render(w, r, http.StatusOK, "signup.page.tmpl", &templateData{
+		Form: forms.New(nil),
+	})
+}
+
+// userSignupPost регистрирует нового пользователя.
+func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
+	if !app.parseForm(w, r) {
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "email", "password")
+	form.MaxLength("name", 255)
+	form.MaxLength("email", 255)
+	form.MatchesPattern("email", forms.EmailRX)
+	form.MinLength("password", 8)
+	form.MaxBytes("password", maxPasswordBytes)
+
+	var id int
+	var err error
+	if form.Valid() {
+		id, err = app.users.Insert(r.Context(), form.Get("name"), form.Get("email"), form.Get("password"))
+		if err != nil {
+			if !errors.Is(err, models.ErrDuplicateEmail) {
+				app.serverError(w, r, err)
+				return
+			}
+			form.Errors.Add("email", "Этот email адрес уже используется")
+		}
+	}
+
+	if !form.Valid() {
+		app.render(w, r, http.StatusUnprocessableEntity, "signup.page.tmpl", &templateData{Form: form})
+		return
+	}
+
+	// Войти можно только после перехода по ссылке из письма.
+	token, err := app.users.NewActivationToken(r.Context(), id, activationTokenTTL)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	link := app.absoluteURL("/user/activate/" + token)
+
+	// Аккаунт уже создан, поэтому ошибку отправки письма только записываем
+	// в лог, а не показываем пользователю страницу с ошибкой.
+	err = app.sendActivationEmail(form.Get("name"), form.Get("email"), link)
+	if err != nil {
+		app.errorLog.Printf("[%s] отправка письма активации: %v", app.requestID(r), err)
+	}
+
+	app.session.Put(r.Context(), "flash", "Регистрация прошла успешно. Мы отправили ссылку для активации аккаунта на ваш email.")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// userActivate активирует аккаунт по токену из ссылки в письме.
+func (app *application) userActivate(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	err := app.users.Activate(r.Context(), params.ByName("token"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.session.Put(r.Context(), "flash", "Ссылка активации недействительна или устарела.")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.session.Put(r.Context(), "flash", "Аккаунт активирован. Пожалуйста, войдите.")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// userLogin отображает форму входа пользователя.
+func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
+	app.render(w, r, http.StatusOK, "login.page.tmpl", &templateData{
+		Form: forms.New(nil),
+	})
+}
+
+// userLoginPost проверяет учетные данные и сохраняет ID пользователя в сессии.
+func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
+	if !app.parseForm(w, r) {
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	id, err := app.users.Authenticate(r.Context(), form.Get("email"), form.Get("password"))
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.Errors.Add("generic", "Неверный email или пароль")
+			app.render(w, r, http.StatusUnprocessableEntity, "login.page.tmpl", &templateData{Form: form})
+		} else if errors.Is(err, models.ErrUserNotActivated) {
+			form.Errors.Add("generic", "Аккаунт не активирован. Перейдите по ссылке из письма, отправленного при регистрации.")
+			app.render(w, r, http.StatusUnprocessableEntity, "login.page.tmpl", &templateData{Form: form})
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Меняем токен сессии при входе, чтобы защититься от атаки
+	// фиксации сессии.
+	err = app.session.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// С отметкой "запомнить меня" cookie сессии сохраняется после закрытия
+	// браузера на весь срок -remember-me-lifetime. Без нее вход действует
+	// не дольше -session-lifetime.
+	if form.Get("rememberMe") != "" {
+		app.session.RememberMe(r.Context(), true)
+		app.session.Remove(r.Context(), "authenticatedUntil")
+	} else {
+		// Срок хранится как Unix время: gob кодек сессии не умеет
+		// кодировать time.Time без предварительной регистрации типа.
+		app.session.RememberMe(r.Context(), false)
+		app.session.Put(r.Context(), "authenticatedUntil", time.Now().Add(app.config.sessionLifetime).Unix())
+	}
+
+	app.session.Put(r.Context(), "authenticatedUserID", id)
+	app.session.Put(r.Context(), "flash", "Вы успешно вошли.")
+
+	// Если перед входом пользователь пытался открыть защищенную страницу,
+	// возвращаем его туда. Иначе перенаправляем на главную страницу.
+	path := app.session.PopString(r.Context(), "redirectPathAfterLogin")
+	if path == "" {
+		path = "/"
+	}
+
+	http.Redirect(w, r, path, http.StatusSeeOther)
+}
+
+// userLogoutPost завершает сессию пользователя.
+func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
+	// Меняем токен сессии, чтобы старый токен нельзя было использовать повторно.
+	err := app.session.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.session.Remove(r.Context(), "authenticatedUserID")
+	app.session.Remove(r.Context(), "authenticatedUntil")
+	app.session.RememberMe(r.Context(), false)
+	app.session.Put(r.Context(), "flash", "Вы успешно вышли.")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// accountView отображает данные текущего пользователя.
+func (app *application) accountView(w http.ResponseWriter, r *http.Request) {
+	app.render(w, r, http.StatusOK, "account.page.tmpl", &templateData{})
+}
+
+// accountSnippets отображает все заметки текущего пользователя, включая
+// заметки с истекшим сроком жизни.
+func (app *application) accountSnippets(w http.ResponseWriter, r *http.Request) {
+	userID := app.session.GetInt(r.Context(), "authenticatedUserID")
+
+	s, err := app.snippets.LatestByUser(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, http.StatusOK, "snippets.page.tmpl", &templateData{
+		Snippets: s,
+	})
+}
+
+// accountPasswordUpdate отображает форму смены пароля.
+func (app *application) accountPasswordUpdate(w http.ResponseWriter, r *http.Request) {
+	app.render(w, r, http.StatusOK, "password.page.tmpl", &templateData{
+		Form: forms.New(nil),
+	})
+}
+
+// accountPasswordUpdatePost меняет пароль текущего пользователя.
+func (app *application) accountPasswordUpdatePost(w http.ResponseWriter, r *http.Request) {
+	if !app.parseForm(w, r) {
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("currentPassword", "newPassword", "newPasswordConfirmation")
+	form.MinLength("newPassword", 8)
+	form.MaxBytes("newPassword", maxPasswordBytes)
+	if form.Get("newPassword") != form.Get("newPasswordConfirmation") {
+		form.Errors.Add("newPasswordConfirmation", "Пароли не совпадают")
+	}
+
+	if form.Valid() {
+		id := app.session.GetInt(r.Context(), "authenticatedUserID")
+
+		err := app.users.PasswordUpdate(r.Context(), id, form.Get("currentPassword"), form.Get("newPassword"))
+		if err != nil {
+			if !errors.Is(err, models.ErrInvalidCredentials) {
+				app.serverError(w, r, err)
+				return
+			}
+			form.Errors.Add("currentPassword", "Неверный текущий пароль")
+		}
+	}
+
+	if !form.Valid() {
+		app.render(w, r, http.StatusUnprocessableEntity, "password.page.tmpl", &templateData{Form: form})
+		return
+	}
+
+	app.session.Put(r.Context(), "flash", "Пароль успешно изменен!")
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// maintenanceToggle включает или выключает режим обслуживания. Запрос должен
+// содержать заголовок Authorization: Bearer <секрет из -maintenance-secret>
+// и параметр enabled со значением true или false.
+func (app *application) maintenanceToggle(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(app.config.maintenanceSecret)) != 1 {
+		app.apiError(w, http.StatusUnauthorized, "неверный секрет")
+		return
+	}
+
+	enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+	if err != nil {
+		app.apiError(w, http.StatusBadRequest, "параметр enabled должен быть true или false")
+		return
+	}
+
+	app.maintenance.Store(enabled)
+	app.infoLog.Printf("[%s] режим обслуживания: %t", app.requestID(r), enabled)
+
+	app.writeJSON(w, http.StatusOK, envelope{"maintenance": enabled})
+}
+
+// healthcheck сообщает о доступности приложения и базы данных в формате JSON.
+func (app *application) healthcheck(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	status := http.StatusOK
+	db := "up"
+
+	err := app.db.PingContext(ctx)
+	if err != nil {
+		app.errorLog.Print(err)
+		status = http.StatusServiceUnavailable
+		db = "down"
+	}
+
+	app.writeJSON(w, status, envelope{"status": "available", "db": db})
 }
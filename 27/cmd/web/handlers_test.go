@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Slava02/SnippetBox/26/pkg/models/mocks"
+	"github.com/Slava02/SnippetBox/26/ui"
+	"github.com/alexedwards/scs/v2"
+)
+
+// newTestApplication возвращает приложение с mock моделями, встроенными
+// шаблонами и логами, которые никуда не пишутся.
+func newTestApplication(t *testing.T) *application {
+	templateCache, err := newTemplateCache(ui.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := scs.New()
+	session.Lifetime = 12 * time.Hour
+	session.Cookie.Secure = true
+
+	var cfg config
+	cfg.requestTimeout = 5 * time.Second
+	cfg.trailingSlash = "strip"
+	cfg.maxBodyBytes = 1 << 20
+	cfg.snippetExpiryOptions = []int{365, 7, 1, 0}
+	cfg.defaultExpiry = 365
+	cfg.staticMaxAge = time.Hour
+	cfg.sessionLifetime = 12 * time.Hour
+	cfg.rememberMeLifetime = 30 * 24 * time.Hour
+	cfg.baseURL = "http://localhost:4000"
+
+	infoLog := log.New(io.Discard, "", 0)
+
+	return &application{
+		config:        cfg,
+		emails:        &logEmailSender{infoLog: infoLog},
+		errorLog:      log.New(io.Discard, "", 0),
+		files:         ui.Files,
+		infoLog:       infoLog,
+		session:       session,
+		snippets:      &mocks.SnippetModel{},
+		templateCache: templateCache,
+		users:         &mocks.UserModel{},
+	}
+}
+
+// testServer - HTTPS сервер для тестов, клиент которого хранит cookie и
+// не следует перенаправлениям.
+type testServer struct {
+	*httptest.Server
+}
+
+func newTestServer(t *testing.T, h http.Handler) *testServer {
+	ts := httptest.NewTLSServer(h)
+	t.Cleanup(ts.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Client().Jar = jar
+
+	ts.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &testServer{ts}
+}
+
+// get выполняет GET запрос и возвращает код состояния, заголовки и тело ответа.
+func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, string) {
+	rs, err := ts.Client().Get(ts.URL + urlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return readResponse(t, rs)
+}
+
+// postForm отправляет данные формы POST запросом.
+func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
+	rs, err := ts.Client().PostForm(ts.URL+urlPath, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return readResponse(t, rs)
+}
+
+func readResponse(t *testing.T, rs *http.Response) (int, http.Header, string) {
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rs.StatusCode, rs.Header, string(bytes.TrimSpace(body))
+}
+
+var csrfTokenRX = regexp.MustCompile(`<input type='hidden' name='csrf_token' value='(.+?)'>`)
+
+// extractCSRFToken возвращает CSRF токен из HTML формы.
+func extractCSRFToken(t *testing.T, body string) string {
+	matches := csrfTokenRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("в теле ответа нет CSRF токена")
+	}
+	return html.UnescapeString(matches[1])
+}
+
+func TestSnippetView(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{"Существующая заметка", "/snippet/view/1", http.StatusOK, "Содержимое тестовой заметки"},
+		{"Несуществующая заметка", "/snippet/view/2", http.StatusNotFound, ""},
+		{"Отрицательный ID", "/snippet/view/-1", http.StatusNotFound, ""},
+		{"Нулевой ID", "/snippet/view/0", http.StatusNotFound, ""},
+		{"Дробный ID", "/snippet/view/1.23", http.StatusNotFound, ""},
+		{"Строковый ID", "/snippet/view/foo", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("код состояния %d, ожидается %d", code, tt.wantCode)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("тело ответа не содержит %q", tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetViewNotModified(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	code, header, _ := ts.get(t, "/snippet/view/1")
+	if code != http.StatusOK {
+		t.Fatalf("код состояния %d, ожидается %d", code, http.StatusOK)
+	}
+	etag := header.Get("ETag")
+	if etag == "" {
+		t.Fatal("ответ не содержит ETag")
+	}
+
+	// Дожидаемся фонового увеличения счетчика просмотров: ETag не должен
+	// от него зависеть.
+	app.wg.Wait()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/snippet/view/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-None-Match", etag)
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, body := readResponse(t, rs)
+
+	if code != http.StatusNotModified {
+		t.Errorf("код состояния %d, ожидается %d", code, http.StatusNotModified)
+	}
+	if body != "" {
+		t.Error("ответ 304 содержит тело")
+	}
+}
+
+func TestUserLoginPost(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		csrf     string
+		wantCode int
+	}{
+		{"Верные данные", "alice@example.com", "pa$$word", csrfToken, http.StatusSeeOther},
+		{"Неверный пароль", "alice@example.com", "wrong", csrfToken, http.StatusUnprocessableEntity},
+		{"Неизвестный email", "bob@example.com", "pa$$word", csrfToken, http.StatusUnprocessableEntity},
+		{"Без CSRF токена", "alice@example.com", "pa$$word", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("email", tt.email)
+			form.Add("password", tt.password)
+			form.Add("csrf_token", tt.csrf)
+
+			code, _, _ := ts.postForm(t, "/user/login", form)
+
+			if code != tt.wantCode {
+				t.Errorf("код состояния %d, ожидается %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestAccountViewAfterLogin(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	code, header, _ := ts.get(t, "/account/view")
+	if code != http.StatusSeeOther || header.Get("Location") != "/user/login" {
+		t.Fatalf("без входа: код %d, Location %q", code, header.Get("Location"))
+	}
+
+	_, _, body := ts.get(t, "/user/login")
+	form := url.Values{}
+	form.Add("email", "alice@example.com")
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	ts.postForm(t, "/user/login", form)
+
+	code, _, body = ts.get(t, "/account/view")
+	if code != http.StatusOK {
+		t.Fatalf("код состояния %d, ожидается %d", code, http.StatusOK)
+	}
+	if !strings.Contains(body, "alice@example.com") {
+		t.Error("страница аккаунта не содержит email пользователя")
+	}
+}
+
+func TestHomePage(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	tests := []struct {
+		name    string
+		urlPath string
+	}{
+		{"Без номера страницы", "/"},
+		{"Первая страница", "/?page=1"},
+		{"Отрицательный номер", "/?page=-5"},
+		{"Нечисловой номер", "/?page=foo"},
+		{"Номер больше числа страниц", "/?page=1000"},
+		{"Огромный номер", "/?page=9223372036854775807"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != http.StatusOK {
+				t.Errorf("код состояния %d, ожидается %d", code, http.StatusOK)
+			}
+			if !strings.Contains(body, "Тестовая заметка") {
+				t.Error("страница не содержит заметку")
+			}
+		})
+	}
+}
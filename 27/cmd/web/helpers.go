@@ -1,46 +1,470 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/netip"
 	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/Slava02/SnippetBox/26/pkg/models"
+	"github.com/julienschmidt/httprouter"
+	"github.com/justinas/nosurf"
 )
 
 // Помощник serverError записывает сообщение об ошибке в errorLog и
 // затем отправляет пользователю ответ 500 "Внутренняя ошибка сервера".
-func (app *application) serverError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
+func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	trace := fmt.Sprintf("[%s] %s\n%s", app.requestID(r), err.Error(), debug.Stack())
 	app.errorLog.Output(2, trace)
 
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	app.errorPage(w, r, http.StatusInternalServerError)
 }
 
 // Помощник clientError отправляет определенный код состояния и соответствующее описание
 // пользователю. Мы будем использовать это в следующий уроках, чтобы отправлять ответы вроде 400 "Bad
 // Request", когда есть проблема с пользовательским запросом.
-func (app *application) clientError(w http.ResponseWriter, status int) {
-	http.Error(w, http.StatusText(status), status)
+func (app *application) clientError(w http.ResponseWriter, r *http.Request, status int) {
+	app.errorPage(w, r, status)
 }
 
 // Мы также реализуем помощник notFound. Это просто
 // удобная оболочка вокруг clientError, которая отправляет пользователю ответ "404 Страница не найдена".
-func (app *application) notFound(w http.ResponseWriter) {
-	app.clientError(w, http.StatusNotFound)
+func (app *application) notFound(w http.ResponseWriter, r *http.Request) {
+	app.clientError(w, r, http.StatusNotFound)
+}
+
+// errorPage отправляет ответ с ошибкой status в подходящем клиенту формате:
+// JSON для маршрутов API, HTML страницу из шаблона 404.page.tmpl,
+// 4xx.page.tmpl или 500.page.tmpl, если клиент принимает text/html, и
+// обычный текст в остальных случаях.
+func (app *application) errorPage(w http.ResponseWriter, r *http.Request, status int) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		app.apiError(w, status, http.StatusText(status))
+		return
+	}
+
+	name := "4xx.page.tmpl"
+	switch {
+	case status == http.StatusNotFound:
+		name = "404.page.tmpl"
+	case status >= 500:
+		name = "500.page.tmpl"
+	}
+
+	ts, ok := app.templateCache[name]
+	if !ok || !acceptsHTML(r.Header.Get("Accept")) {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	// Ошибка может произойти и вне middleware сессии, например для
+	// неизвестного маршрута, поэтому addDefaultData здесь не используется
+	// и flash сообщение остается в сессии до следующей страницы.
+	nonce, _ := r.Context().Value(nonceContextKey).(string)
+	user := app.authenticatedUser(r)
+	td := &templateData{
+		CSRFToken:         nosurf.Token(r),
+		Nonce:             nonce,
+		IsAuthenticated:   user != nil,
+		AuthenticatedUser: user,
+		Status:            status,
+		StatusText:        http.StatusText(status),
+	}
+
+	// При ошибке выполнения шаблона нельзя вызывать serverError, так как
+	// он снова попадет сюда, поэтому отправляем обычный текст.
+	buf := new(bytes.Buffer)
+	if err := ts.Execute(buf, td); err != nil {
+		app.errorLog.Printf("[%s] %s", app.requestID(r), err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// acceptsHTML сообщает, указан ли text/html в заголовке Accept и не
+// запрещен ли он значением q=0.
+func acceptsHTML(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		if strings.TrimSpace(mediaType) != "text/html" {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		weight, err := strconv.ParseFloat(q, 64)
+		return err == nil && weight > 0
+	}
+	return false
+}
+
+// Помощник addDefaultData добавляет в шаблон данные, которые нужны на
+// каждой странице.
+func (app *application) addDefaultData(td *templateData, r *http.Request) *templateData {
+	if td == nil {
+		td = &templateData{}
+	}
+	td.CSRFToken = nosurf.Token(r)
+	td.IsAuthenticated = app.isAuthenticated(r)
+	td.AuthenticatedUser = app.authenticatedUser(r)
+	td.Nonce, _ = r.Context().Value(nonceContextKey).(string)
+	// Извлекаем flash сообщение из сессии. PopString() удаляет его,
+	// поэтому сообщение будет показано только один раз.
+	td.Flash = app.session.PopString(r.Context(), "flash")
+	return td
 }
 
-func (app *application) render(w http.ResponseWriter, r *http.Request, name string, td *templateData) {
+// Помощник render отображает шаблон name с кодом состояния status.
+func (app *application) render(w http.ResponseWriter, r *http.Request, status int, name string, td *templateData) {
 	// Извлекаем соответствующий набор шаблонов из кэша в зависимости от названия страницы
 	// (например, 'home.page.tmpl'). Если в кэше нет записи запрашиваемого шаблона, то
 	// вызывается вспомогательный метод serverError(), который мы создали ранее.
+	// Ответ 304 Not Modified не должен содержать тела, поэтому шаблон
+	// не выполняется.
+	if status == http.StatusNotModified {
+		w.WriteHeader(status)
+		return
+	}
+
 	ts, ok := app.templateCache[name]
 	if !ok {
-		app.serverError(w, fmt.Errorf("Шаблон %s не существует!", name))
+		app.serverError(w, r, fmt.Errorf("Шаблон %s не существует!", name))
 		return
 	}
 
-	// Рендерим файлы шаблона, передавая динамические данные из переменной `td`.
-	err := ts.Execute(w, td)
+	// Сначала рендерим шаблон в буфер, а не сразу в http.ResponseWriter.
+	// Если при выполнении шаблона произойдет ошибка, пользователь получит
+	// страницу с ошибкой 500, а не наполовину отрисованную страницу.
+	buf := new(bytes.Buffer)
+
+	err := ts.Execute(buf, app.addDefaultData(td, r))
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Шаблон отрисован успешно, записываем код состояния и содержимое буфера.
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// parseForm разбирает данные формы запроса. При ошибке помощник сам
+// отправляет ответ: 413, если тело запроса превысило -max-body-bytes,
+// и 400 в остальных случаях. Возвращает false, если обработку нужно прервать.
+func (app *application) parseForm(w http.ResponseWriter, r *http.Request) bool {
+	err := r.ParseForm()
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.bodyTooLarge(w, r)
+		} else {
+			app.clientError(w, r, http.StatusBadRequest)
+		}
+		return false
+	}
+	return true
+}
+
+// Помощник bodyTooLarge отправляет ответ 413 с указанием допустимого
+// размера тела запроса. Для JSON API ответ отправляется в формате JSON.
+func (app *application) bodyTooLarge(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("Тело запроса слишком большое: допускается не более %d байт", app.config.maxBodyBytes)
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		app.apiError(w, http.StatusRequestEntityTooLarge, message)
+		return
+	}
+	http.Error(w, message, http.StatusRequestEntityTooLarge)
+}
+
+// isAuthenticated возвращает true, если в сессии текущего запроса
+// сохранен ID аутентифицированного пользователя.
+func (app *application) isAuthenticated(r *http.Request) bool {
+	return app.session.Exists(r.Context(), "authenticatedUserID")
+}
+
+// Помощник writeJSON кодирует data в JSON и отправляет его пользователю
+// с указанным кодом состояния.
+func (app *application) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		app.errorLog.Output(2, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
+}
+
+// Помощник apiError отправляет JSON ответ вида {"error": message}. В message
+// передается строка или, для ошибок валидации, карта поле -> сообщение.
+func (app *application) apiError(w http.ResponseWriter, status int, message interface{}) {
+	app.writeJSON(w, status, envelope{"error": message})
+}
+
+// readJSON декодирует JSON тело запроса в dst. Неизвестные поля считаются
+// ошибкой. Ошибки декодера заменяются понятными сообщениями, а ошибка
+// *http.MaxBytesError возвращается как есть.
+func (app *application) readJSON(r *http.Request, dst interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("некорректный JSON (позиция %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("некорректный JSON")
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("поле %q имеет неверный тип, ожидается %s", unmarshalTypeError.Field, unmarshalTypeError.Type)
+			}
+			return fmt.Errorf("неверный тип значения (позиция %d)", unmarshalTypeError.Offset)
+		case errors.Is(err, io.EOF):
+			return errors.New("тело запроса не должно быть пустым")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return fmt.Errorf("неизвестное поле %s", field)
+		default:
+			// В том числе *http.MaxBytesError, который обрабатывает вызывающий код.
+			return err
+		}
+	}
+
+	// Тело запроса должно содержать ровно один JSON объект.
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return errors.New("тело запроса должно содержать только один JSON объект")
+	}
+
+	return nil
+}
+
+// Помощник apiServerError записывает ошибку в errorLog и отправляет
+// JSON ответ 500 "Внутренняя ошибка сервера".
+func (app *application) apiServerError(w http.ResponseWriter, r *http.Request, err error) {
+	trace := fmt.Sprintf("[%s] %s\n%s", app.requestID(r), err.Error(), debug.Stack())
+	app.errorLog.Output(2, trace)
+
+	app.apiError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
+
+// authenticatedUser возвращает текущего пользователя, загруженного
+// middleware authenticate, или nil для анонимных запросов.
+func (app *application) authenticatedUser(r *http.Request) *models.User {
+	user, ok := r.Context().Value(authenticatedUserContextKey).(*models.User)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
+// ownedSnippet загружает заметку id и проверяет, что её автор - текущий
+// пользователь. Если заметка не найдена или принадлежит другому пользователю
+// (в том числе если она анонимная), помощник сам отправляет ответ с ошибкой
+// и возвращает false.
+func (app *application) ownedSnippet(w http.ResponseWriter, r *http.Request, id int) (*models.Snippet, bool) {
+	userID := app.session.GetInt(r.Context(), "authenticatedUserID")
+
+	s, err := app.snippets.Get(r.Context(), id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	if s.UserID == 0 || s.UserID != userID {
+		app.clientError(w, r, http.StatusForbidden)
+		return nil, false
+	}
+
+	return s, true
+}
+
+// requestID возвращает идентификатор текущего запроса, присвоенный
+// middleware addRequestID, или пустую строку, если его нет.
+func (app *application) requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// background выполняет fn в отдельной горутине. Паника в fn записывается
+// в errorLog и не завершает приложение, а main дожидается завершения всех
+// таких горутин перед закрытием пула подключений к базе данных.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				app.errorLog.Printf("%s\n%s", err, debug.Stack())
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// readIDParam извлекает параметр id из маршрута и проверяет, что это
+// положительное целое число.
+func (app *application) readIDParam(r *http.Request) (int, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("некорректный параметр id: %q", params.ByName("id"))
+	}
+
+	return id, nil
+}
+
+// expiryOptions возвращает допустимые сроки жизни заметки в виде строк
+// для PermittedValues() и формы создания заметки.
+func (app *application) expiryOptions() []string {
+	options := make([]string, len(app.config.snippetExpiryOptions))
+	for i, days := range app.config.snippetExpiryOptions {
+		options[i] = strconv.Itoa(days)
+	}
+	return options
+}
+
+// defaultExpiry возвращает срок жизни заметки по умолчанию в виде строки.
+func (app *application) defaultExpiry() string {
+	return strconv.Itoa(app.config.defaultExpiry)
+}
+
+// realIP возвращает IP адрес клиента. Заголовкам X-Forwarded-For и X-Real-IP
+// можно доверять, только если запрос пришел напрямую от прокси из
+// -trusted-proxies, иначе клиент мог бы подставить в них любой адрес.
+// X-Forwarded-For просматривается справа налево: каждый прокси добавляет
+// адрес в конец, поэтому клиентом считается первый адрес, не
+// принадлежащий доверенному прокси.
+func (app *application) realIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+
+	if !app.isTrustedProxy(peer) {
+		return peer
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		ip := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				break
+			}
+			ip = addr.Unmap().String()
+			if !app.isTrustedProxy(ip) {
+				break
+			}
+		}
+		return ip
+	}
+
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap().String()
+	}
+
+	return peer
+}
+
+// isTrustedProxy сообщает, принадлежит ли адрес ip одной из подсетей
+// -trusted-proxies.
+func (app *application) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range app.config.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// absoluteURL возвращает абсолютную ссылку на путь path внутри приложения,
+// построенную от адреса из флага -base-url. Заголовок Host запроса для
+// этого не используется, так как его задает клиент.
+func (app *application) absoluteURL(path string) string {
+	return strings.TrimRight(app.config.baseURL, "/") + "/" + strings.TrimLeft(path, "/")
+}
+
+// snippetETag возвращает слабый ETag страницы заметки. В него входит хеш
+// полей заметки, которые выводятся на странице, поэтому тег меняется после
+// редактирования. Счетчик просмотров в хеш не входит: он растет при каждом
+// просмотре, и иначе ответ 304 не отправлялся бы никогда. Из-за этого
+// закэшированная страница может показывать устаревшее число просмотров.
+// Кроме того, от просматривающего пользователя зависят элементы управления
+// для автора, а от оставшегося срока жизни - предложение продлить заметку.
+func snippetETag(s *models.Snippet, viewerID int) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d %q %q %q %q %q %d %d %d %t",
+		s.ID, s.Title, s.Content, s.Language, s.Visibility, s.Tags,
+		s.Created.UnixNano(), s.Expires.UnixNano(), s.ForkedFrom, expiresSoon(s.Expires))
+	return fmt.Sprintf(`W/"%x-%d"`, h.Sum(nil)[:16], viewerID)
+}
+
+// etagMatches сообщает, совпадает ли etag с одним из значений заголовка
+// If-None-Match. Используется слабое сравнение, поэтому префикс W/ не
+// учитывается.
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// countLines возвращает количество строк в content: число переводов строки
+// плюс один. Пустая строка не содержит строк, а после завершающего
+// перевода строки считается еще одна пустая строка.
+func countLines(content string) int {
+	if content == "" {
+		return 0
+	}
+	return strings.Count(content, "\n") + 1
+}
+
+// splitTags разбивает строку с тегами, перечисленными через запятую,
+// на отдельные теги, отбрасывая пустые значения.
+func splitTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
 	}
+	return tags
 }
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestCountLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+	}{
+		{"Пустая строка", "", 0},
+		{"Одна строка", "a", 1},
+		{"Завершающий перевод строки", "a\n", 2},
+		{"Две строки", "a\nb", 2},
+		{"Перевод строки Windows", "a\r\nb", 2},
+		{"Только переводы строк", "\n\n", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countLines(tt.content); got != tt.want {
+				t.Errorf("countLines(%q) = %d, ожидается %d", tt.content, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// snippetLanguages - языки, которые можно выбрать в форме создания заметки.
+// Значение none означает обычный текст без подсветки.
+var snippetLanguages = []string{"none", "go", "python", "javascript", "typescript", "java", "c", "cpp", "rust", "sql", "bash", "html", "css", "json", "yaml"}
+
+// highlighter форматирует код в HTML с CSS классами вместо встроенных
+// стилей, так как Content-Security-Policy запрещает атрибут style. Сами
+// стили лежат в ui/static/css/chroma.css.
+var highlighter = html.New(html.WithClasses(true))
+
+// highlight возвращает content с подсветкой синтаксиса языка language. Для
+// языка none, неизвестного языка или при ошибке разбора возвращается пустая
+// строка, и шаблон показывает экранированный текст как есть.
+func highlight(content, language string) template.HTML {
+	if language == "" || language == "none" {
+		return ""
+	}
+
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		return ""
+	}
+
+	iterator, err := lexer.Tokenise(nil, content)
+	if err != nil {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	err = highlighter.Format(&buf, styles.Get("github"), iterator)
+	if err != nil {
+		return ""
+	}
+
+	// Форматтер экранирует содержимое токенов, поэтому результат
+	// безопасно вставлять в шаблон без повторного экранирования.
+	return template.HTML(buf.String())
+}
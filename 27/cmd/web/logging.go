@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jsonLogWriter превращает каждую строку, записанную через log.Logger,
+// в отдельный JSON объект с полями time, level и msg.
+type jsonLogWriter struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level string
+}
+
+// newJSONLogger создает log.Logger, который пишет в out JSON объекты
+// с указанным уровнем. Так логгер остается совместимым с http.Server.ErrorLog
+// и помощником serverError().
+func newJSONLogger(out io.Writer, level string, flag int) *log.Logger {
+	return log.New(&jsonLogWriter{out: out, level: level}, "", flag)
+}
+
+func (w *jsonLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+
+	// Для ошибок все, что идет после первой строки (например, стек вызовов
+	// из serverError()), выносим в отдельное поле trace.
+	var trace string
+	if w.level == "ERROR" {
+		if i := strings.IndexByte(msg, '\n'); i >= 0 {
+			msg, trace = msg[:i], msg[i+1:]
+		}
+	}
+
+	err := w.writeEntry(msg, trace, nil)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeEntry записывает одну JSON запись, добавляя к ней дополнительные поля.
+func (w *jsonLogWriter) writeEntry(msg, trace string, fields map[string]string) error {
+	entry := make(map[string]string, len(fields)+4)
+	for k, v := range fields {
+		entry[k] = v
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339)
+	entry["level"] = w.level
+	entry["msg"] = msg
+	if trace != "" {
+		entry["trace"] = trace
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, err = w.out.Write(append(b, '\n'))
+	return err
+}
@@ -1,73 +1,377 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
-	"flag"
+	"errors"
+	"fmt"
 	"html/template" // Новый импорт
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/Slava02/SnippetBox/26/pkg/models"
 	"github.com/Slava02/SnippetBox/26/pkg/models/mysql"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/Slava02/SnippetBox/26/ui"
+	"github.com/alexedwards/scs/v2"
+	mysqldriver "github.com/go-sql-driver/mysql"
 )
 
 // Добавляем поле templateCache в структуру зависимостей. Это позволит
 // получить доступ к кэшу во всех обработчиках.
 type application struct {
+	config        config
+	db            *sql.DB
+	emails        emailSender
 	errorLog      *log.Logger
+	files         fs.FS
 	infoLog       *log.Logger
-	snippets      *mysql.SnippetModel
+	session       *scs.SessionManager
+	snippets      models.SnippetModelInterface
 	templateCache map[string]*template.Template
+	users         models.UserModelInterface
+	// maintenance - включен ли сейчас режим обслуживания. Значение можно
+	// изменить во время работы через POST /admin/maintenance.
+	maintenance atomic.Bool
+	// wg отслеживает фоновые горутины, запущенные через app.background().
+	wg sync.WaitGroup
 }
 
 func main() {
-	addr := flag.String("addr", ":4000", "Сетевой адрес веб-сервера")
-	dsn := flag.String("dsn", "web:pass@/snippetbox?parseTime=true", "Название MySQL источника данных")
-	flag.Parse()
+	cfg := loadConfig()
 
 	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 
-	db, err := openDB(*dsn)
+	switch cfg.logFormat {
+	case "text":
+	case "json":
+		infoLog = newJSONLogger(os.Stdout, "INFO", 0)
+		errorLog = newJSONLogger(os.Stderr, "ERROR", log.Lshortfile)
+	default:
+		errorLog.Fatalf("Неизвестный формат логов %q", cfg.logFormat)
+	}
+
+	err := cfg.validate()
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	db, err := openDB(cfg.dsn, cfg, infoLog)
 	if err != nil {
 		errorLog.Fatal(err)
 	}
-	defer db.Close()
+
+	// В режиме -create-user создаем пользователя и завершаем работу,
+	// не запуская сервер.
+	if cfg.createUser.enabled {
+		err = createUser(db, cfg)
+		db.Close()
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		return
+	}
+
+	// Реплика открывается с теми же настройками пула и TLS, что и основная
+	// база данных.
+	var replica *sql.DB
+	if cfg.replicaDSN != "" {
+		replica, err = openDB(cfg.replicaDSN, cfg, infoLog)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	// По умолчанию шаблоны и статические файлы берутся из исполняемого
+	// файла. При разработке шаблонов удобнее читать их с диска, чтобы
+	// не пересобирать приложение. Временем изменения встроенных файлов
+	// считается время сборки исполняемого файла.
+	var files fs.FS = withModTime(ui.Files, executableModTime())
+	if !cfg.useEmbedded {
+		files = os.DirFS("./ui")
+	}
 
 	// Инициализируем новый кэш шаблона...
-	templateCache, err := newTemplateCache("./ui/html/")
+	templateCache, err := newTemplateCache(files)
 	if err != nil {
 		errorLog.Fatal(err)
 	}
 
+	// Инициализируем менеджер сессий. Cookie недоступна из JavaScript и не
+	// отправляется при межсайтовых POST запросах. По умолчанию cookie сессии
+	// удаляется при закрытии браузера. Срок хранения сессии равен сроку
+	// "запомнить меня", а вход без этой отметки ограничивается сроком
+	// -session-lifetime в middleware authenticate.
+	session := scs.New()
+	session.Lifetime = cfg.rememberMeLifetime
+	session.Cookie.Persist = false
+	session.Cookie.HttpOnly = true
+	session.Cookie.SameSite = http.SameSiteLaxMode
+	session.Cookie.Secure = cfg.useTLS()
+
 	// И добавляем его в зависимостях нашего
 	// веб-приложения.
 	app := &application{
-		errorLog:      errorLog,
-		infoLog:       infoLog,
-		snippets:      &mysql.SnippetModel{DB: db},
+		config:   cfg,
+		db:       db,
+		emails:   &logEmailSender{infoLog: infoLog},
+		errorLog: errorLog,
+		files:    files,
+		infoLog:  infoLog,
+		session:  session,
+		snippets: &mysql.CachedSnippetModel{
+			SnippetModel: &mysql.SnippetModel{DB: db, Replica: replica, Timeout: cfg.dbTimeout, Dedupe: cfg.dedupe},
+			TTL:          cfg.homeCacheTTL,
+		},
 		templateCache: templateCache,
+		users:         &mysql.UserModel{DB: db, Timeout: cfg.dbTimeout, BcryptCost: cfg.bcryptCost, ErrorLog: errorLog},
+	}
+	app.maintenance.Store(cfg.maintenance)
+
+	// Разрешаем только TLS 1.2 и выше и предпочитаем эллиптические кривые
+	// и наборы шифров на их основе.
+	tlsConfig := &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		},
 	}
 
+	// Время записи ответа должно быть больше времени обработки запроса,
+	// иначе соединение закроется раньше, чем клиент получит ответ 503.
 	srv := &http.Server{
-		Addr:     *addr,
-		ErrorLog: errorLog,
-		Handler:  app.routes(),
+		Addr:         cfg.addr,
+		ErrorLog:     errorLog,
+		Handler:      app.routes(),
+		TLSConfig:    tlsConfig,
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: cfg.requestTimeout + 5*time.Second,
+	}
+
+	scheme := "http"
+	if cfg.useTLS() {
+		scheme = "https"
+	}
+	stopCleanup := app.startSnippetCleanup(cfg.cleanupInterval)
+
+	if cfg.debug {
+		infoLog.Print("Включены отладочные маршруты /debug/pprof/ и /debug/vars")
 	}
 
-	infoLog.Printf("Запуск сервера на http://127.0.0.1%s", *addr)
-	err = srv.ListenAndServe()
-	errorLog.Fatal(err)
+	infoLog.Printf("Запуск сервера на %s://127.0.0.1%s", scheme, cfg.addr)
+	err = app.serve(srv)
+
+	// Останавливаем фоновую очистку и дожидаемся фоновых задач до
+	// закрытия пула подключений.
+	stopCleanup()
+	app.wg.Wait()
+
+	// Пул подключений к базе данных закрываем только после того, как
+	// сервер завершил обработку всех запросов.
+	db.Close()
+	if replica != nil {
+		replica.Close()
+	}
+
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	infoLog.Print("Сервер корректно остановлен")
 }
 
-func openDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn)
+// serve запускает сервер и блокируется до получения сигнала SIGINT или SIGTERM,
+// после чего дает текущим запросам до 10 секунд на завершение. Метод возвращает
+// nil при корректной остановке и ошибку, если сервер не смог запуститься.
+func (app *application) serve(srv *http.Server) error {
+	serverErr := make(chan error, 1)
+	go func() {
+		if app.config.useTLS() {
+			serverErr <- srv.ListenAndServeTLS(app.config.tlsCert, app.config.tlsKey)
+		} else {
+			serverErr <- srv.ListenAndServe()
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	select {
+	case err := <-serverErr:
+		return err
+	case sig := <-quit:
+		app.infoLog.Printf("Получен сигнал %s, остановка сервера", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		return err
+	}
+
+	// После вызова Shutdown() метод ListenAndServe() (или ListenAndServeTLS()) сразу возвращает
+	// http.ErrServerClosed, это ожидаемое поведение.
+	err = <-serverErr
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// openDB открывает пул подключений к базе данных dsn с настройками пула из cfg
+// и повторяет проверку подключения до cfg.dbConnectRetries раз.
+func openDB(dsn string, cfg config, infoLog *log.Logger) (*sql.DB, error) {
+	dsn, err := dsnWithTLS(dsn, cfg.dbTLS)
 	if err != nil {
 		return nil, err
 	}
-	if err = db.Ping(); err != nil {
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
 		return nil, err
 	}
-	return db, nil
+
+	db.SetMaxOpenConns(cfg.dbMaxOpenConns)
+	db.SetMaxIdleConns(cfg.dbMaxIdleConns)
+	db.SetConnMaxIdleTime(cfg.dbMaxIdleTime)
+
+	// При одновременном запуске с MySQL (например, в docker-compose) база
+	// данных может быть еще не готова принимать подключения, поэтому
+	// проверяем подключение несколько раз, удваивая паузу между попытками.
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		err = db.Ping()
+		if err == nil {
+			return db, nil
+		}
+		if attempt >= cfg.dbConnectRetries {
+			db.Close()
+			return nil, fmt.Errorf("не удалось подключиться к базе данных за %d попыток: %w", attempt, err)
+		}
+
+		infoLog.Printf("Подключение к базе данных не удалось (попытка %d из %d): %v. Повтор через %s",
+			attempt, cfg.dbConnectRetries, err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// createUser создает пользователя из флагов -user-name, -user-email и
+// -user-password и выводит его ID. Такой пользователь активируется сразу,
+// так как письмо с активацией ему не отправляется.
+func createUser(db *sql.DB, cfg config) error {
+	users := &mysql.UserModel{DB: db, Timeout: cfg.dbTimeout, BcryptCost: cfg.bcryptCost}
+	ctx := context.Background()
+
+	id, err := users.Insert(ctx, cfg.createUser.name, cfg.createUser.email, cfg.createUser.password)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			return fmt.Errorf("пользователь с email %s уже существует: %w", cfg.createUser.email, err)
+		}
+		return err
+	}
+
+	token, err := users.NewActivationToken(ctx, id, time.Minute)
+	if err != nil {
+		return err
+	}
+	err = users.Activate(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Создан пользователь с ID %d\n", id)
+	return nil
+}
+
+// dsnWithTLS добавляет в dsn параметр tls в соответствии со значением флага
+// -db-tls: false оставляет dsn без изменений, true и skip-verify передаются
+// драйверу как есть, а любое другое значение считается путем к PEM файлу
+// с CA сертификатом, которым проверяется сертификат сервера MySQL.
+func dsnWithTLS(dsn, mode string) (string, error) {
+	if mode == "" || mode == "false" {
+		return dsn, nil
+	}
+
+	dbCfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+
+	switch mode {
+	case "true", "skip-verify":
+		dbCfg.TLSConfig = mode
+	default:
+		pem, err := os.ReadFile(mode)
+		if err != nil {
+			return "", fmt.Errorf("не удалось прочитать CA сертификат для -db-tls: %w", err)
+		}
+
+		rootCertPool := x509.NewCertPool()
+		if !rootCertPool.AppendCertsFromPEM(pem) {
+			return "", fmt.Errorf("файл %s не содержит PEM сертификатов", mode)
+		}
+
+		err = mysqldriver.RegisterTLSConfig("custom", &tls.Config{
+			RootCAs:    rootCertPool,
+			MinVersion: tls.VersionTLS12,
+		})
+		if err != nil {
+			return "", err
+		}
+		dbCfg.TLSConfig = "custom"
+	}
+
+	return dbCfg.FormatDSN(), nil
+}
+
+// startSnippetCleanup запускает фоновую горутину, которая каждые interval
+// удаляет анонимные заметки с истекшим сроком жизни. Возвращаемая функция
+// останавливает горутину и дожидается ее завершения.
+func (app *application) startSnippetCleanup(interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				n, err := app.snippets.DeleteExpired(context.Background())
+				if err != nil {
+					app.errorLog.Print(err)
+					continue
+				}
+				app.infoLog.Printf("Удалено истекших анонимных заметок: %d", n)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+	}
 }
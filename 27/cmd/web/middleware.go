@@ -1,29 +1,509 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Slava02/SnippetBox/26/pkg/models"
+	"github.com/justinas/nosurf"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
 )
 
+// Prometheus metrics collected by the metrics middleware.
+var (
+	totalRequests = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "snippetbox_http_requests_total",
+		Help: "Total number of HTTP requests received.",
+	})
+	totalResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "snippetbox_http_responses_total",
+		Help: "Total number of HTTP responses sent, by status code.",
+	}, []string{"code"})
+	requestDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "snippetbox_http_request_duration_seconds",
+		Help:    "Duration of HTTP request processing in seconds.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+// secureHeaders sets security-related headers on every response. Inline
+// scripts are only allowed with the nonce generated for the current
+// request, which templates get through templateData.Nonce.
 func secureHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 16 random bytes give the nonce 128 bits of entropy.
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		nonce := base64.StdEncoding.EncodeToString(b[:])
+
 		// Note: This is split across multiple lines for readability. You don't
 		// need to do this in your own code.
 		w.Header().Set("Content-Security-Policy",
-			"default-src 'self'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com")
+			"default-src 'self'; script-src 'self' 'nonce-"+nonce+"'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com")
 
 		w.Header().Set("Referrer-Policy", "origin-when-cross-origin")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		w.Header().Set("X-Frame-Options", "deny")
 		w.Header().Set("X-XSS-Protection", "0")
 
-		next.ServeHTTP(w, r)
+		ctx := context.WithValue(r.Context(), nonceContextKey, nonce)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// logRequest записывает в infoLog строку о каждом запросе после того, как
+// ответ отправлен: IP клиента, протокол, метод, URI, код состояния, размер
+// ответа в байтах и время обработки.
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.infoLog.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.URL.RequestURI())
+		start := time.Now()
+
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sr, r)
+
+		latency := time.Since(start)
+
+		ip := app.realIP(r)
+
+		// With the JSON log format the request details are written as
+		// separate fields instead of a single formatted message.
+		if jw, ok := app.infoLog.Writer().(*jsonLogWriter); ok {
+			jw.writeEntry("request", "", map[string]string{
+				"remote_ip":  ip,
+				"proto":      r.Proto,
+				"method":     r.Method,
+				"uri":        r.URL.RequestURI(),
+				"status":     strconv.Itoa(sr.status),
+				"size":       strconv.Itoa(sr.size),
+				"latency":    latency.String(),
+				"request_id": app.requestID(r),
+			})
+		} else {
+			app.infoLog.Printf("[%s] %s - %s %s %s %d %dB %s", app.requestID(r), ip, r.Proto, r.Method,
+				r.URL.RequestURI(), sr.status, sr.size, latency)
+		}
+	})
+}
+
+// addRequestID присваивает каждому запросу идентификатор. Если клиент или
+// прокси уже передали заголовок X-Request-ID, используется его значение,
+// иначе генерируется новый UUID. Идентификатор сохраняется в контексте
+// запроса и возвращается в заголовке ответа.
+func addRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 128 {
+			id = newUUID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// newUUID генерирует случайный UUID версии 4.
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// enableCORS разрешает запросы к API со страниц из источников, перечисленных
+// во флаге -cors-trusted-origins. Для остальных источников CORS заголовки не
+// добавляются, и браузер заблокирует ответ. Preflight запросы от доверенных
+// источников получают ответ 200 со списком разрешенных методов и заголовков.
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Ответ зависит от заголовка Origin, поэтому кэши должны это учитывать.
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		origin := r.Header.Get("Origin")
+		if origin != "" && slices.Contains(app.config.corsTrustedOrigins, origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+				w.Header().Set("Access-Control-Max-Age", "600")
+
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitRequestBody ограничивает размер тела POST, PUT и PATCH запросов
+// значением -max-body-bytes. Если размер известен заранее из заголовка
+// Content-Length, запрос сразу отклоняется с кодом 413. Иначе чтение тела
+// прерывается с ошибкой *http.MaxBytesError при превышении лимита.
+func (app *application) limitRequestBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+			if r.ContentLength > app.config.maxBodyBytes {
+				app.bodyTooLarge(w, r)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, app.config.maxBodyBytes)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Create a deferred function (which will always be run in the event
+		// of a panic as Go unwinds the stack).
+		defer func() {
+			// Use the builtin recover function to check if there has been a
+			// panic or not. If there has...
+			if err := recover(); err != nil {
+				// Set a "Connection: close" header on the response.
+				w.Header().Set("Connection", "close")
+				// Call the app.serverError helper method to return a 500
+				// Internal Server response. It logs the error together with
+				// the stack trace to the errorLog.
+				app.serverError(w, r, fmt.Errorf("%s", err))
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) requireAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// If the user is not authenticated, redirect them to the login page and
+		// return from the middleware chain so that no subsequent handlers in
+		// the chain are executed. For GET requests we remember the requested
+		// path so that the user can be sent back there after logging in.
+		if !app.isAuthenticated(r) {
+			if r.Method == http.MethodGet {
+				app.session.Put(r.Context(), "redirectPathAfterLogin", r.URL.RequestURI())
+			}
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+
+		// Otherwise set the "Cache-Control: no-store" header so that pages
+		// which require authentication are not stored in the users browser cache
+		// (or other intermediary cache).
+		w.Header().Add("Cache-Control", "no-store")
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve the authenticatedUserID value from the session. If it
+		// isn't present, call the next handler in the chain as normal.
+		id := app.session.GetInt(r.Context(), "authenticatedUserID")
+		if id == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Вход без отметки "запомнить меня" действует ограниченное время,
+		// хотя сама сессия может храниться дольше.
+		until := app.session.GetInt64(r.Context(), "authenticatedUntil")
+		if until != 0 && time.Now().Unix() > until {
+			app.session.Remove(r.Context(), "authenticatedUserID")
+			app.session.Remove(r.Context(), "authenticatedUntil")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Otherwise, look up the user in the database. If the user no longer
+		// exists (e.g. the account was deleted while the session was still
+		// alive), quietly remove the key from the session.
+		user, err := app.users.Get(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.session.Remove(r.Context(), "authenticatedUserID")
+				next.ServeHTTP(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		// Store the user in the request context so that handlers and
+		// templates can access it.
+		ctx := context.WithValue(r.Context(), authenticatedUserContextKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Create a noSurf middleware function which uses a customized CSRF cookie with
+// the Secure, Path, HttpOnly and SameSite attributes set. Requests that fail
+// the token check get a 400 Bad Request response.
+func (app *application) noSurf(next http.Handler) http.Handler {
+	csrfHandler := nosurf.New(next)
+	csrfHandler.SetBaseCookie(http.Cookie{
+		HttpOnly: true,
+		Path:     "/",
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	csrfHandler.SetFailureHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.clientError(w, r, http.StatusBadRequest)
+	}))
+
+	return csrfHandler
+}
+
+// timeout limits the time a handler may take to app.config.requestTimeout.
+// http.TimeoutHandler also sets a deadline on the request context, and the
+// models derive their query contexts from it, so a timed-out request
+// cancels its database queries as well. When the deadline is exceeded the
+// client gets a 503 Service Unavailable response. The snippet export is
+// exempt, as http.TimeoutHandler buffers the whole response and the export
+// is streamed to the client instead.
+func (app *application) timeout(next http.Handler) http.Handler {
+	th := http.TimeoutHandler(next, app.config.requestTimeout, "Сервер не успел обработать запрос. Попробуйте позже.")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/account/export" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		th.ServeHTTP(w, r)
+	})
+}
+
+// trailingSlash redirects GET and HEAD requests to the canonical form of
+// the path according to -trailing-slash: without the trailing slash for
+// "strip" and with it for "add". Other methods are never redirected, as the
+// client could lose the request body; they're routed as if the canonical
+// path had been requested. Routes are registered without trailing slashes,
+// so in "add" mode the slash is removed again before routing. Static files
+// and paths that look like file names (feed.atom) are left alone.
+func (app *application) trailingSlash(next http.Handler) http.Handler {
+	if app.config.trailingSlash == "off" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Path
+		if p == "/" || strings.HasPrefix(p, "/static/") || strings.Contains(path.Base(p), ".") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		hasSlash := strings.HasSuffix(p, "/")
+		redirect := r.Method == http.MethodGet || r.Method == http.MethodHead
+
+		if redirect && hasSlash != (app.config.trailingSlash == "add") {
+			target := strings.TrimRight(r.URL.EscapedPath(), "/")
+			if app.config.trailingSlash == "add" {
+				target += "/"
+			}
+			// A path like //example.com/ must not become a redirect to
+			// another host.
+			target = "/" + strings.TrimLeft(target, "/")
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+
+		if hasSlash {
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.URL = new(url.URL)
+			*r2.URL = *r.URL
+			r2.URL.Path = "/" + strings.Trim(p, "/")
+			r2.URL.RawPath = ""
+			r = r2
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// maintenanceRetryAfter is sent in the Retry-After header of responses
+// served in maintenance mode.
+const maintenanceRetryAfter = 5 * time.Minute
+
+// maintenanceMode answers every request with 503 Service Unavailable while
+// maintenance mode is on. Static files are still served so that the
+// maintenance page is styled. The health check, metrics and the admin
+// endpoint are registered on the root mux and never reach this middleware.
+func (app *application) maintenanceMode(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.maintenance.Load() || strings.HasPrefix(r.URL.Path, "/static/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(maintenanceRetryAfter.Seconds())))
+		w.Header().Set("Cache-Control", "no-store")
+
+		// The session isn't loaded outside the router, so the page is
+		// rendered without addDefaultData.
+		buf := new(bytes.Buffer)
+		ts, ok := app.templateCache["maintenance.page.tmpl"]
+		if ok {
+			nonce, _ := r.Context().Value(nonceContextKey).(string)
+			ok = ts.Execute(buf, &templateData{Nonce: nonce}) == nil
+		}
+		if !ok {
+			http.Error(w, "Сайт временно недоступен из-за технических работ.", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+		buf.WriteTo(w)
+	})
+}
+
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	// If rate limiting is disabled there is nothing to do.
+	if !app.config.limiter.enabled {
+		return next
+	}
+
+	// Define a client struct to hold the rate limiter and last seen time for
+	// each client.
+	type client struct {
+		limiter  *rate.Limiter
+		lastSeen time.Time
+	}
+
+	var (
+		mu      sync.Mutex
+		clients = make(map[string]*client)
+	)
+
+	// Launch a background goroutine which removes old entries from the
+	// clients map once every minute.
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+
+			mu.Lock()
+			for ip, client := range clients {
+				if time.Since(client.lastSeen) > 3*time.Minute {
+					delete(clients, ip)
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := app.realIP(r)
+
+		mu.Lock()
+
+		if _, found := clients[ip]; !found {
+			clients[ip] = &client{
+				limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst),
+			}
+		}
+		clients[ip].lastSeen = time.Now()
+
+		// Reserve a token. If it's not available right away, cancel the
+		// reservation and tell the client how long to wait before retrying.
+		res := clients[ip].limiter.Reserve()
+		delay := res.Delay()
+		if delay > 0 {
+			res.Cancel()
+		}
+
+		mu.Unlock()
+
+		if delay > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			app.clientError(w, r, http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder wraps a http.ResponseWriter and records the status code
+// and the number of body bytes written by downstream handlers.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int
+	wroteHeader bool
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if !sr.wroteHeader {
+		sr.status = status
+		sr.wroteHeader = true
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	// A Write without an explicit WriteHeader call means 200 OK.
+	if !sr.wroteHeader {
+		sr.status = http.StatusOK
+		sr.wroteHeader = true
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.size += n
+	return n, err
+}
+
+// Unwrap returns the original http.ResponseWriter so that
+// http.ResponseController can reach it.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+func metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Don't measure the metrics endpoint itself.
+		if r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		totalRequests.Inc()
+
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sr, r)
+
+		totalResponses.WithLabelValues(strconv.Itoa(sr.status)).Inc()
+		requestDuration.Observe(time.Since(start).Seconds())
+	})
+}
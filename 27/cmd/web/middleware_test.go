@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrailingSlash(t *testing.T) {
+	tests := []struct {
+		mode         string
+		method       string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+		wantPath     string
+	}{
+		{"strip", http.MethodGet, "/snippet/view/1/", http.StatusMovedPermanently, "/snippet/view/1", ""},
+		{"strip", http.MethodGet, "/tag/go/?page=2", http.StatusMovedPermanently, "/tag/go?page=2", ""},
+		{"strip", http.MethodGet, "//evil/", http.StatusMovedPermanently, "/evil", ""},
+		{"strip", http.MethodGet, "/snippet/view/1", http.StatusOK, "", "/snippet/view/1"},
+		{"strip", http.MethodPost, "/snippet/create/", http.StatusOK, "", "/snippet/create"},
+		{"strip", http.MethodPost, "/snippet/create", http.StatusOK, "", "/snippet/create"},
+		{"strip", http.MethodGet, "/", http.StatusOK, "", "/"},
+		{"strip", http.MethodGet, "/static/css/", http.StatusOK, "", "/static/css/"},
+		{"strip", http.MethodGet, "/static/css/main.css", http.StatusOK, "", "/static/css/main.css"},
+
+		{"add", http.MethodGet, "/snippet/view/1", http.StatusMovedPermanently, "/snippet/view/1/", ""},
+		{"add", http.MethodGet, "/tag/go?page=2", http.StatusMovedPermanently, "/tag/go/?page=2", ""},
+		{"add", http.MethodGet, "/snippet/view/1/", http.StatusOK, "", "/snippet/view/1"},
+		{"add", http.MethodPost, "/snippet/create", http.StatusOK, "", "/snippet/create"},
+		{"add", http.MethodPost, "/snippet/create/", http.StatusOK, "", "/snippet/create"},
+		{"add", http.MethodGet, "/", http.StatusOK, "", "/"},
+		{"add", http.MethodGet, "/static/css", http.StatusOK, "", "/static/css"},
+		{"add", http.MethodGet, "/feed.atom", http.StatusOK, "", "/feed.atom"},
+
+		{"off", http.MethodGet, "/snippet/view/1/", http.StatusOK, "", "/snippet/view/1/"},
+		{"off", http.MethodGet, "/snippet/view/1", http.StatusOK, "", "/snippet/view/1"},
+		{"off", http.MethodPost, "/snippet/create/", http.StatusOK, "", "/snippet/create/"},
+		{"off", http.MethodGet, "/", http.StatusOK, "", "/"},
+		{"off", http.MethodGet, "/static/css/", http.StatusOK, "", "/static/css/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode+" "+tt.method+" "+tt.urlPath, func(t *testing.T) {
+			app := &application{}
+			app.config.trailingSlash = tt.mode
+
+			var gotPath string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+			})
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.urlPath, nil)
+
+			app.trailingSlash(next).ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("код состояния %d, ожидается %d", rr.Code, tt.wantCode)
+			}
+			if location := rr.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("Location %q, ожидается %q", location, tt.wantLocation)
+			}
+			if gotPath != tt.wantPath {
+				t.Errorf("обработчик получил путь %q, ожидается %q", gotPath, tt.wantPath)
+			}
+		})
+	}
+}
@@ -1,17 +1,132 @@
 package main
 
-import "net/http"
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/justinas/alice"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
 
 func (app *application) routes() http.Handler {
-	mux := http.NewServeMux()
+	router := httprouter.New()
+
+	// Trailing slashes are handled by the trailingSlash middleware
+	// according to -trailing-slash, so the router's own redirects are off.
+	router.RedirectTrailingSlash = false
+
+	// Use our own notFound helper for unknown routes, so that 404 responses
+	// are consistent across the application.
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.notFound(w, r)
+	})
+
+	// A known path requested with an unsupported method gets a 405 instead
+	// of a 404. The router sets the Allow header listing the permitted
+	// methods before calling this handler.
+	router.HandleMethodNotAllowed = true
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+	})
+
+	// Static files are served from the same file system as the templates.
+	// The request path /static/... maps directly to the static directory
+	// inside it, so no prefix stripping is needed. Browsers may cache them
+	// for -static-max-age.
+	router.Handler(http.MethodGet, "/static/*filepath", app.staticCache(http.FileServerFS(app.files)))
+
+	// Middleware chain for the dynamic application routes. Static files
+	// don't need the session or CSRF protection, so they're registered
+	// without it.
+	dynamic := alice.New(app.session.LoadAndSave, app.noSurf, app.authenticate)
+
+	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
+	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetView))
+	router.Handler(http.MethodGet, "/snippet/view/:id/raw", dynamic.ThenFunc(app.snippetViewRaw))
+	router.Handler(http.MethodGet, "/snippets/search", dynamic.ThenFunc(app.snippetSearch))
+	router.Handler(http.MethodGet, "/tag/:name", dynamic.ThenFunc(app.snippetsByTag))
+
+	// The feed has no per-user content, so it doesn't need the session.
+	router.HandlerFunc(http.MethodGet, "/feed.atom", app.feedAtom)
+
+	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignup))
+	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignupPost))
+	router.Handler(http.MethodGet, "/user/activate/:token", dynamic.ThenFunc(app.userActivate))
+	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
+	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
+
+	// Routes that change snippets are only available to logged-in users.
+	protected := dynamic.Append(app.requireAuthentication)
+
+	router.Handler(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreateForm))
+	router.Handler(http.MethodPost, "/snippet/create", protected.ThenFunc(app.snippetCreate))
+	router.Handler(http.MethodGet, "/snippet/edit/:id", protected.ThenFunc(app.snippetEdit))
+	router.Handler(http.MethodPost, "/snippet/edit/:id", protected.ThenFunc(app.snippetEditPost))
+	router.Handler(http.MethodPost, "/snippet/delete/:id", protected.ThenFunc(app.snippetDelete))
+	router.Handler(http.MethodPost, "/snippet/extend/:id", protected.ThenFunc(app.snippetExtend))
+	router.Handler(http.MethodGet, "/snippet/view/:id/history", protected.ThenFunc(app.snippetHistory))
+	router.Handler(http.MethodGet, "/snippet/view/:id/fork", protected.ThenFunc(app.snippetFork))
+	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+	router.Handler(http.MethodGet, "/account/view", protected.ThenFunc(app.accountView))
+	router.Handler(http.MethodGet, "/account/snippets", protected.ThenFunc(app.accountSnippets))
+	router.Handler(http.MethodGet, "/account/export", protected.ThenFunc(app.accountExport))
+	router.Handler(http.MethodPost, "/account/import", protected.ThenFunc(app.accountImport))
+	router.Handler(http.MethodGet, "/account/password/update", protected.ThenFunc(app.accountPasswordUpdate))
+	router.Handler(http.MethodPost, "/account/password/update", protected.ThenFunc(app.accountPasswordUpdatePost))
+
+	// The JSON API doesn't use cookies, so it's registered without the
+	// session and CSRF middleware. It may be called from other origins, so
+	// the routes get CORS headers. The OPTIONS routes are registered
+	// explicitly, otherwise httprouter would answer preflight requests
+	// itself before enableCORS sees them.
+	api := alice.New(app.enableCORS)
+
+	router.Handler(http.MethodGet, "/api/v1/snippets", api.ThenFunc(app.apiSnippetList))
+	router.Handler(http.MethodGet, "/api/v1/snippets/:id", api.ThenFunc(app.apiSnippetView))
+	router.Handler(http.MethodPost, "/api/v1/snippets", api.ThenFunc(app.apiSnippetCreate))
+	router.Handler(http.MethodOptions, "/api/v1/snippets", api.ThenFunc(app.apiOptions))
+	router.Handler(http.MethodOptions, "/api/v1/snippets/:id", api.ThenFunc(app.apiOptions))
+
+	// The health check and metrics are served by a separate top-level mux
+	// so that they bypass the rate limiter and session middleware, and
+	// monitoring doesn't consume the request quota. The request timeout is
+	// applied to the router only: it holds all the application and API
+	// routes except the streamed snippet export, while long-running
+	// endpoints like the CPU profile live on the root mux.
+	root := http.NewServeMux()
+	root.HandleFunc("GET /healthcheck", app.healthcheck)
+	root.Handle("GET /metrics", promhttp.Handler())
+	root.Handle("/", app.trailingSlash(app.maintenanceMode(app.rateLimit(app.timeout(router)))))
+
+	// Maintenance mode can be toggled at runtime by a request carrying the
+	// shared secret. The endpoint stays available while maintenance mode is
+	// on, and is rate limited to make guessing the secret impractical.
+	if app.config.maintenanceSecret != "" {
+		root.Handle("POST /admin/maintenance", app.rateLimit(http.HandlerFunc(app.maintenanceToggle)))
+	}
 
-	fileServer := http.FileServer(http.Dir("./ui/static/"))
-	mux.Handle("/static/", http.StripPrefix("/static", fileServer))
+	// The profiling and runtime variable endpoints expose internal details
+	// of the process, so they're only mounted when -debug is set. Like the
+	// health check they bypass the rate limiter and session middleware.
+	if app.config.debug {
+		root.HandleFunc("GET /debug/pprof/", pprof.Index)
+		root.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+		root.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+		root.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+		root.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+		root.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+		root.Handle("GET /debug/vars", expvar.Handler())
+	}
 
-	mux.HandleFunc("/", app.home)
-	mux.HandleFunc("/snippet", app.snippetView)
-	mux.HandleFunc("/snippet/create", app.snippetCreate)
+	// logRequest goes right after addRequestID so that it sees the final
+	// status, including the 500 written by recoverPanic, and the size of the
+	// response as sent to the client. compress sits outside recoverPanic so
+	// that the 500 response written after a panic still goes through the
+	// gzip writer, which is then properly closed. recoverPanic catches panics
+	// from everything downstream.
+	standard := alice.New(addRequestID, app.logRequest, compress, app.recoverPanic, metrics, secureHeaders, app.limitRequestBody)
 
-	// Wrap the existing chain with the logRequest middleware.
-	return app.logRequest(secureHeaders(mux))
+	return standard.Then(root)
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMethodNotAllowed(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	tests := []struct {
+		name      string
+		method    string
+		urlPath   string
+		wantCode  int
+		wantAllow []string
+	}{
+		{"POST к странице заметки", http.MethodPost, "/snippet/view/1", http.StatusMethodNotAllowed, []string{"GET"}},
+		{"DELETE к форме входа", http.MethodDelete, "/user/login", http.StatusMethodNotAllowed, []string{"GET", "POST"}},
+		{"GET к удалению заметки", http.MethodGet, "/snippet/delete/1", http.StatusMethodNotAllowed, []string{"POST"}},
+		{"Неизвестный путь", http.MethodGet, "/missing", http.StatusNotFound, nil},
+		{"POST к неизвестному пути", http.MethodPost, "/missing", http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.urlPath, nil)
+
+			routes.ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("код состояния %d, ожидается %d", rr.Code, tt.wantCode)
+			}
+
+			allow := rr.Header().Get("Allow")
+			if tt.wantAllow == nil && allow != "" {
+				t.Errorf("заголовок Allow %q, ожидается пустой", allow)
+			}
+			for _, method := range tt.wantAllow {
+				if !strings.Contains(allow, method) {
+					t.Errorf("заголовок Allow %q не содержит %s", allow, method)
+				}
+			}
+			if strings.Contains(allow, tt.method) {
+				t.Errorf("заголовок Allow %q содержит запрошенный метод %s", allow, tt.method)
+			}
+		})
+	}
+}
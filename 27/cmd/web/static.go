@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// staticCache разрешает браузерам хранить статические файлы в кэше в
+// течение -static-max-age, не запрашивая их повторно. Заголовки
+// добавляются только к успешным ответам, поэтому ошибки не кэшируются.
+// HTML файлы и списки файлов каталогов не кэшируются. Last-Modified и
+// обработку If-Modified-Since обеспечивает http.FileServer по времени
+// изменения файла.
+func (app *application) staticCache(next http.Handler) http.Handler {
+	if app.config.staticMaxAge <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ext := path.Ext(r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/") || ext == ".html" || ext == ".htm" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(&staticCacheWriter{ResponseWriter: w, maxAge: app.config.staticMaxAge}, r)
+	})
+}
+
+// staticCacheWriter добавляет заголовки кэширования перед отправкой
+// успешного ответа.
+type staticCacheWriter struct {
+	http.ResponseWriter
+	maxAge      time.Duration
+	wroteHeader bool
+}
+
+func (cw *staticCacheWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+
+		h := cw.Header()
+		cacheable := status == http.StatusOK || status == http.StatusPartialContent || status == http.StatusNotModified
+		if cacheable && !strings.HasPrefix(h.Get("Content-Type"), "text/html") {
+			h.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(cw.maxAge.Seconds())))
+			h.Set("Expires", time.Now().Add(cw.maxAge).UTC().Format(http.TimeFormat))
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *staticCacheWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Unwrap возвращает исходный http.ResponseWriter для http.ResponseController.
+func (cw *staticCacheWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// executableModTime возвращает время изменения исполняемого файла, то есть
+// время сборки приложения, или текущее время, если его не удалось узнать.
+func executableModTime() time.Time {
+	exe, err := os.Executable()
+	if err != nil {
+		return time.Now()
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		return time.Now()
+	}
+	return info.ModTime()
+}
+
+// withModTime возвращает файловую систему, в которой файлы без времени
+// изменения сообщают modTime. У встроенных через embed файлов время
+// изменения нулевое, и без этого http.FileServer не отправлял бы
+// Last-Modified и не отвечал бы 304 на If-Modified-Since.
+func withModTime(fsys fs.FS, modTime time.Time) fs.FS {
+	return modTimeFS{fsys: fsys, modTime: modTime}
+}
+
+type modTimeFS struct {
+	fsys    fs.FS
+	modTime time.Time
+}
+
+func (m modTimeFS) Open(name string) (fs.File, error) {
+	f, err := m.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return modTimeFile{File: f, modTime: m.modTime}, nil
+}
+
+type modTimeFile struct {
+	fs.File
+	modTime time.Time
+}
+
+func (f modTimeFile) Stat() (fs.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil || !info.ModTime().IsZero() {
+		return info, err
+	}
+	return modTimeInfo{FileInfo: info, modTime: f.modTime}, nil
+}
+
+// Seek и ReadDir нужны http.FileServer для отдачи файлов и списка
+// файлов каталога. Они передаются исходному файлу, если он их поддерживает.
+func (f modTimeFile) Seek(offset int64, whence int) (int64, error) {
+	s, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, errors.New("seek not supported")
+	}
+	return s.Seek(offset, whence)
+}
+
+func (f modTimeFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	d, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Err: errors.New("not a directory")}
+	}
+	return d.ReadDir(n)
+}
+
+type modTimeInfo struct {
+	fs.FileInfo
+	modTime time.Time
+}
+
+func (i modTimeInfo) ModTime() time.Time {
+	return i.modTime
+}
@@ -1,24 +1,131 @@
 package main
 
 import (
+	"github.com/Slava02/SnippetBox/26/pkg/forms"
 	"github.com/Slava02/SnippetBox/26/pkg/models"
 	"html/template" // новый импорт
-	"path/filepath" // новый импорт
+	"io/fs"
+	"path"
+	"strconv"
+	"time"
 )
 
 type templateData struct {
+	// CSRFToken содержит CSRF токен для скрытого поля в формах.
+	CSRFToken string
+	// Flash содержит одноразовое сообщение для пользователя.
+	Flash string
+	// Nonce - nonce текущего запроса для атрибута nonce встроенных скриптов.
+	Nonce string
+	// IsAuthenticated сообщает, вошел ли пользователь в систему, а
+	// AuthenticatedUser содержит его данные.
+	IsAuthenticated   bool
+	AuthenticatedUser *models.User
+	// CurrentPage и TotalPages используются для постраничной навигации.
+	CurrentPage int
+	TotalPages  int
+	// Form хранит введенные пользователем данные и ошибки валидации
+	// для повторного отображения формы.
+	Form *forms.Form
+	// IsSearch и SearchQuery используются на странице результатов поиска.
+	IsSearch    bool
+	SearchQuery string
+	// Tag содержит название тега на странице заметок с этим тегом.
+	Tag      string
 	Snippet  *models.Snippet
 	Snippets []*models.Snippet
+	// Highlighted содержит содержимое заметки с подсветкой синтаксиса
+	// или пустую строку, если подсветка не нужна.
+	Highlighted template.HTML
+	// SizeBytes и LineCount - размер содержимого заметки в байтах
+	// и количество строк в нем.
+	SizeBytes int
+	LineCount int
+	// Languages - языки для выпадающего списка в форме создания заметки,
+	// ExpiryOptions - допустимые сроки жизни заметки в днях.
+	Languages     []string
+	ExpiryOptions []string
+	// Revisions - предыдущие версии заметки на странице истории изменений.
+	Revisions []revisionDiff
+	// ImportedCount и ImportErrors - результат импорта заметок из файла.
+	ImportedCount int
+	ImportErrors  []importError
+	// Status и StatusText - код состояния и его описание на странице ошибки.
+	Status     int
+	StatusText string
 }
 
-func newTemplateCache(dir string) (map[string]*template.Template, error) {
+// humanDate возвращает время t в удобном для чтения виде в UTC. Для
+// нулевого времени возвращается пустая строка.
+func humanDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("02 Jan 2006 at 15:04")
+}
+
+// expired сообщает, истек ли срок жизни t. Нулевое время означает заметку
+// без срока жизни, которая не истекает никогда.
+func expired(t time.Time) bool {
+	return !t.IsZero() && !t.After(time.Now())
+}
+
+// expiresSoonWindow - за сколько до истечения срока жизни автору
+// предлагается продлить заметку.
+const expiresSoonWindow = 3 * 24 * time.Hour
+
+// expiresSoon сообщает, что срок жизни t истекает в ближайшие
+// expiresSoonWindow. Заметки без срока жизни не истекают никогда.
+func expiresSoon(t time.Time) bool {
+	return !t.IsZero() && time.Until(t) < expiresSoonWindow
+}
+
+// expiryLabel возвращает подпись к сроку жизни заметки days, заданному
+// строкой с количеством дней.
+func expiryLabel(days string) string {
+	switch days {
+	case "0":
+		return "Никогда"
+	case "1":
+		return "Один день"
+	case "7":
+		return "Одна неделя"
+	case "365":
+		return "Один год"
+	}
+
+	n, err := strconv.Atoi(days)
+	if err != nil {
+		return days
+	}
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return days + " день"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return days + " дня"
+	default:
+		return days + " дней"
+	}
+}
+
+// Функции, доступные внутри шаблонов.
+var functions = template.FuncMap{
+	"add":         func(a, b int) int { return a + b },
+	"humanDate":   humanDate,
+	"expired":     expired,
+	"expiresSoon": expiresSoon,
+	"expiryLabel": expiryLabel,
+}
+
+// newTemplateCache разбирает шаблоны из каталога html файловой системы fsys.
+func newTemplateCache(fsys fs.FS) (map[string]*template.Template, error) {
 	// Инициализируем новую карту, которая будет хранить кэш.
 	cache := map[string]*template.Template{}
 
-	// Используем функцию filepath.Glob, чтобы получить срез всех файловых путей с
+	// Используем функцию fs.Glob, чтобы получить срез всех файловых путей с
 	// расширением '.page.tmpl'. По сути, мы получим список всех файлов шаблонов для страниц
 	// нашего веб-приложения.
-	pages, err := filepath.Glob(filepath.Join(dir, "*.page.tmpl"))
+	pages, err := fs.Glob(fsys, "html/*.page.tmpl")
 	if err != nil {
 		return nil, err
 	}
@@ -27,24 +134,24 @@ func newTemplateCache(dir string) (map[string]*template.Template, error) {
 	for _, page := range pages {
 		// Извлечение конечное названия файла (например, 'home.page.tmpl') из полного пути к файлу
 		// и присваивание его переменной name.
-		name := filepath.Base(page)
+		name := path.Base(page)
 
 		// Обрабатываем итерируемый файл шаблона.
-		ts, err := template.ParseFiles(page)
+		ts, err := template.New(name).Funcs(functions).ParseFS(fsys, page)
 		if err != nil {
 			return nil, err
 		}
 
-		// Используем метод ParseGlob для добавления всех каркасных шаблонов.
+		// Используем метод ParseFS для добавления всех каркасных шаблонов.
 		// В нашем случае это только файл base.layout.tmpl (основная структура шаблона).
-		ts, err = ts.ParseGlob(filepath.Join(dir, "*.layout.tmpl"))
+		ts, err = ts.ParseFS(fsys, "html/*.layout.tmpl")
 		if err != nil {
 			return nil, err
 		}
 
-		// Используем метод ParseGlob для добавления всех вспомогательных шаблонов.
+		// Используем метод ParseFS для добавления всех вспомогательных шаблонов.
 		// В нашем случае это footer.partial.tmpl "подвал" нашего шаблона.
-		ts, err = ts.ParseGlob(filepath.Join(dir, "*.partial.tmpl"))
+		ts, err = ts.ParseFS(fsys, "html/*.partial.tmpl")
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHumanDate(t *testing.T) {
+	tests := []struct {
+		name string
+		tm   time.Time
+		want string
+	}{
+		{"UTC", time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC), "17 Mar 2024 at 10:15"},
+		{"Нулевое время", time.Time{}, ""},
+		{"CET", time.Date(2024, 3, 17, 10, 15, 0, 0, time.FixedZone("CET", 1*60*60)), "17 Mar 2024 at 09:15"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := humanDate(tt.tm); got != tt.want {
+				t.Errorf("humanDate() = %q, ожидается %q", got, tt.want)
+			}
+		})
+	}
+}
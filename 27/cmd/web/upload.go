@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Slava02/SnippetBox/26/pkg/forms"
+)
+
+// uploadMaxMemory - объем multipart формы, который хранится в памяти.
+// Остальное сохраняется во временные файлы. Общий размер тела запроса
+// ограничен limitRequestBody.
+const uploadMaxMemory = 1 << 20
+
+// utf8BOM - метка порядка байтов, которую некоторые редакторы добавляют
+// в начало UTF-8 файлов.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// isMultipart возвращает true, если тело запроса передано в формате
+// multipart/form-data.
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// parseSnippetUpload разбирает multipart форму создания заметки. Если
+// пользователь загрузил файл в поле file, его содержимое заменяет поле
+// content, а имя файла используется как заголовок, если тот не указан.
+// Двоичные файлы и файлы не в кодировке UTF-8 отклоняются ошибкой
+// валидации. При ошибке разбора помощник сам отправляет ответ и
+// возвращает false.
+func (app *application) parseSnippetUpload(w http.ResponseWriter, r *http.Request) (*forms.Form, bool) {
+	err := r.ParseMultipartForm(uploadMaxMemory)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.bodyTooLarge(w, r)
+		} else {
+			app.clientError(w, r, http.StatusBadRequest)
+		}
+		return nil, false
+	}
+
+	form := forms.New(r.PostForm)
+
+	file, header, err := r.FormFile("file")
+	if errors.Is(err, http.ErrMissingFile) {
+		// Файл не выбран - используется содержимое текстового поля.
+		return form, true
+	}
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return nil, false
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		app.serverError(w, r, err)
+		return nil, false
+	}
+	content = bytes.TrimPrefix(content, utf8BOM)
+
+	if !utf8.Valid(content) || bytes.IndexByte(content, 0) != -1 {
+		form.Errors.Add("file", "Файл должен быть текстовым в кодировке UTF-8")
+		return form, true
+	}
+	form.Set("content", string(content))
+
+	if strings.TrimSpace(form.Get("title")) == "" {
+		form.Set("title", uploadTitle(header.Filename))
+	}
+
+	return form, true
+}
+
+// uploadTitle формирует заголовок заметки из имени загруженного файла,
+// обрезая его до допустимой длины.
+func uploadTitle(filename string) string {
+	// Браузеры передают только имя файла, но путь все равно отбрасывается.
+	name := filepath.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+
+	title := []rune(name)
+	if len(title) > 100 {
+		title = title[:100]
+	}
+	return string(title)
+}
@@ -2,6 +2,26 @@ module github.com/Slava02/SnippetBox/26
 
 go 1.22.3
 
-require github.com/go-sql-driver/mysql v1.8.1
+require (
+	github.com/alecthomas/chroma/v2 v2.14.0
+	github.com/alexedwards/scs/v2 v2.8.0
+	github.com/go-sql-driver/mysql v1.8.1
+	github.com/julienschmidt/httprouter v1.3.0
+	github.com/justinas/alice v1.2.0
+	github.com/justinas/nosurf v1.1.1
+	github.com/prometheus/client_golang v1.19.1
+	golang.org/x/crypto v0.31.0
+	golang.org/x/time v0.5.0
+)
 
-require filippo.io/edwards25519 v1.1.0 // indirect
+require (
+	filippo.io/edwards25519 v1.1.0 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dlclark/regexp2 v1.11.0 // indirect
+	github.com/prometheus/client_model v0.5.0 // indirect
+	github.com/prometheus/common v0.48.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
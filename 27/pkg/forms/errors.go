@@ -0,0 +1,30 @@
+package forms
+
+// errors хранит сообщения об ошибках валидации для каждого поля формы.
+// Ключом карты является название поля.
+type errors map[string][]string
+
+// Add добавляет сообщение об ошибке для указанного поля.
+func (e errors) Add(field, message string) {
+	e[field] = append(e[field], message)
+}
+
+// Get возвращает первое сообщение об ошибке для указанного поля
+// или пустую строку, если ошибок нет.
+func (e errors) Get(field string) string {
+	es := e[field]
+	if len(es) == 0 {
+		return ""
+	}
+	return es[0]
+}
+
+// First возвращает карту с первым сообщением об ошибке для каждого поля.
+// Используется для отправки ошибок валидации в JSON ответах.
+func (e errors) First() map[string]string {
+	first := make(map[string]string, len(e))
+	for field := range e {
+		first[field] = e.Get(field)
+	}
+	return first
+}
@@ -0,0 +1,99 @@
+package forms
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// EmailRX - регулярное выражение для проверки формата email адреса.
+var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+
+// Form содержит данные формы и ошибки их валидации.
+type Form struct {
+	url.Values
+	Errors errors
+}
+
+// New создает новую форму из переданных данных.
+func New(data url.Values) *Form {
+	return &Form{
+		data,
+		errors(map[string][]string{}),
+	}
+}
+
+// Required проверяет, что указанные поля не пустые.
+func (f *Form) Required(fields ...string) {
+	for _, field := range fields {
+		value := f.Get(field)
+		if strings.TrimSpace(value) == "" {
+			f.Errors.Add(field, "Это поле не может быть пустым")
+		}
+	}
+}
+
+// MaxLength проверяет, что длина поля не превышает d символов.
+func (f *Form) MaxLength(field string, d int) {
+	value := f.Get(field)
+	if value == "" {
+		return
+	}
+	if utf8.RuneCountInString(value) > d {
+		f.Errors.Add(field, fmt.Sprintf("Это поле слишком длинное (максимум %d символов)", d))
+	}
+}
+
+// MinLength проверяет, что длина поля без пробельных символов в начале и
+// в конце не меньше d символов, поэтому значение из одних пробелов
+// отклоняется. Пустое поле пропускается, его проверяет Required.
+func (f *Form) MinLength(field string, d int) {
+	value := f.Get(field)
+	if value == "" {
+		return
+	}
+	if utf8.RuneCountInString(strings.TrimSpace(value)) < d {
+		f.Errors.Add(field, fmt.Sprintf("Это поле слишком короткое (минимум %d символов)", d))
+	}
+}
+
+// MaxBytes проверяет, что значение поля занимает не больше n байт. Нужно
+// там, где ограничение задано в байтах, а не в символах, например для
+// паролей, которые хешируются bcrypt.
+func (f *Form) MaxBytes(field string, n int) {
+	if len(f.Get(field)) > n {
+		f.Errors.Add(field, fmt.Sprintf("Это поле слишком длинное (максимум %d байт)", n))
+	}
+}
+
+// PermittedValues проверяет, что значение поля совпадает с одним из opts.
+func (f *Form) PermittedValues(field string, opts ...string) {
+	value := f.Get(field)
+	if value == "" {
+		return
+	}
+	for _, opt := range opts {
+		if value == opt {
+			return
+		}
+	}
+	f.Errors.Add(field, "Это поле недопустимо")
+}
+
+// MatchesPattern проверяет, что значение поля соответствует регулярному выражению.
+func (f *Form) MatchesPattern(field string, pattern *regexp.Regexp) {
+	value := f.Get(field)
+	if value == "" {
+		return
+	}
+	if !pattern.MatchString(value) {
+		f.Errors.Add(field, "Это поле недопустимо")
+	}
+}
+
+// Valid возвращает true, если в форме нет ошибок.
+func (f *Form) Valid() bool {
+	return len(f.Errors) == 0
+}
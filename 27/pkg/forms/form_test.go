@@ -0,0 +1,34 @@
+package forms
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestMinLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		min     int
+		wantErr bool
+	}{
+		{"Пустое поле", "", 1, false},
+		{"Один символ", "a", 1, false},
+		{"Только пробелы", "   ", 1, true},
+		{"Переводы строк и табуляция", "\n\t\r\n", 1, true},
+		{"Символ среди пробелов", "  a  ", 1, false},
+		{"Короткое значение с пробелами", "  abc   ", 8, true},
+		{"Кириллица", "пароль12", 8, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := New(url.Values{"content": {tt.value}})
+			form.MinLength("content", tt.min)
+
+			if gotErr := form.Errors.Get("content") != ""; gotErr != tt.wantErr {
+				t.Errorf("ошибка валидации %t, ожидается %t", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
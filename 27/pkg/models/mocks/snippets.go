@@ -0,0 +1,154 @@
+// Package mocks содержит реализации моделей, которые возвращают заранее
+// заданные данные и не требуют подключения к базе данных.
+package mocks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Slava02/SnippetBox/26/pkg/models"
+)
+
+// mockSnippet - единственная заметка, которую "хранит" mocks.SnippetModel.
+// Ее срок жизни истекает в далеком будущем, чтобы заметка оставалась
+// актуальной независимо от даты запуска тестов.
+var mockSnippet = &models.Snippet{
+	ID:         1,
+	Title:      "Тестовая заметка",
+	Content:    "Содержимое тестовой заметки",
+	Created:    time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+	Expires:    time.Date(2100, 1, 1, 10, 0, 0, 0, time.UTC),
+	Tags:       []string{"test"},
+	UserID:     1,
+	Visibility: models.VisibilityPublic,
+	Language:   "none",
+}
+
+// SnippetModel реализует models.SnippetModelInterface без базы данных.
+// Существует только заметка с ID 1, новые заметки получают ID 2.
+// IncrementViews увеличивает счетчик просмотров этой заметки, а Get
+// возвращает ее копию с текущим значением счетчика.
+type SnippetModel struct {
+	mu    sync.Mutex
+	views int
+}
+
+var _ models.SnippetModelInterface = (*SnippetModel)(nil)
+
+func (m *SnippetModel) Insert(ctx context.Context, userID, forkedFrom int, title, content, expires, visibility, language string, tags []string) (int, error) {
+	if userID > 0 && userID == mockSnippet.UserID && title == mockSnippet.Title && content == mockSnippet.Content {
+		return mockSnippet.ID, models.ErrDuplicateSnippet
+	}
+	return 2, nil
+}
+
+func (m *SnippetModel) InsertBatch(ctx context.Context, userID int, snippets []models.NewSnippet) error {
+	return nil
+}
+
+func (m *SnippetModel) Get(ctx context.Context, id, viewerID int) (*models.Snippet, error) {
+	switch id {
+	case 1:
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		s := *mockSnippet
+		s.ViewCount += m.views
+		return &s, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) GetByTag(ctx context.Context, tag string) ([]*models.Snippet, error) {
+	if tag == "test" {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return nil, nil
+}
+
+func (m *SnippetModel) Latest(ctx context.Context) ([]*models.Snippet, error) {
+	return []*models.Snippet{mockSnippet}, nil
+}
+
+func (m *SnippetModel) LatestPaged(ctx context.Context, limit, offset int) ([]*models.Snippet, error) {
+	if offset > 0 {
+		return nil, nil
+	}
+	return []*models.Snippet{mockSnippet}, nil
+}
+
+func (m *SnippetModel) LatestByUser(ctx context.Context, userID int) ([]*models.Snippet, error) {
+	if userID == mockSnippet.UserID {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return nil, nil
+}
+
+func (m *SnippetModel) AllByUser(ctx context.Context, userID int) ([]*models.Snippet, error) {
+	if userID == mockSnippet.UserID {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return nil, nil
+}
+
+func (m *SnippetModel) Search(ctx context.Context, query string) ([]*models.Snippet, error) {
+	return []*models.Snippet{mockSnippet}, nil
+}
+
+func (m *SnippetModel) Count(ctx context.Context) (int, error) {
+	return 1, nil
+}
+
+func (m *SnippetModel) Update(ctx context.Context, id int, title, content string, expires int) error {
+	if id != 1 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *SnippetModel) Extend(ctx context.Context, id, userID, days int) error {
+	if id != 1 {
+		return models.ErrNoRecord
+	}
+	if userID != mockSnippet.UserID {
+		return models.ErrForbidden
+	}
+	return nil
+}
+
+func (m *SnippetModel) Delete(ctx context.Context, id int) error {
+	if id != 1 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *SnippetModel) DeleteExpired(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (m *SnippetModel) IncrementViews(ctx context.Context, id int) error {
+	if id != 1 {
+		return models.ErrNoRecord
+	}
+
+	m.mu.Lock()
+	m.views++
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *SnippetModel) Revisions(ctx context.Context, snippetID int) ([]*models.Revision, error) {
+	if snippetID != 1 {
+		return nil, nil
+	}
+	return []*models.Revision{{
+		ID:        1,
+		SnippetID: 1,
+		Title:     "Тестовая заметка",
+		Content:   "Прежнее содержимое тестовой заметки",
+		Created:   time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+	}}, nil
+}
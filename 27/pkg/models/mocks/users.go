@@ -0,0 +1,72 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"github.com/Slava02/SnippetBox/26/pkg/models"
+)
+
+// mockUser - единственный пользователь, которого "хранит" mocks.UserModel.
+// Он является автором mockSnippet.
+var mockUser = &models.User{
+	ID:        1,
+	Name:      "Alice",
+	Email:     "alice@example.com",
+	Created:   time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+	Activated: true,
+}
+
+// mockPassword - пароль mockUser.
+const mockPassword = "pa$$word"
+
+// mockActivationToken - единственный действующий токен активации.
+const mockActivationToken = "MOCKACTIVATIONTOKEN"
+
+// UserModel реализует models.UserModelInterface без базы данных.
+// Существует только пользователь с ID 1, новые пользователи получают ID 2.
+type UserModel struct{}
+
+var _ models.UserModelInterface = (*UserModel)(nil)
+
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) (int, error) {
+	if email == mockUser.Email {
+		return 0, models.ErrDuplicateEmail
+	}
+	return 2, nil
+}
+
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
+	if email == mockUser.Email && password == mockPassword {
+		return mockUser.ID, nil
+	}
+	return 0, models.ErrInvalidCredentials
+}
+
+func (m *UserModel) Get(ctx context.Context, id int) (*models.User, error) {
+	if id != mockUser.ID {
+		return nil, models.ErrNoRecord
+	}
+	return mockUser, nil
+}
+
+func (m *UserModel) PasswordUpdate(ctx context.Context, id int, currentPassword, newPassword string) error {
+	if id != mockUser.ID {
+		return models.ErrNoRecord
+	}
+	if currentPassword != mockPassword {
+		return models.ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (m *UserModel) NewActivationToken(ctx context.Context, userID int, ttl time.Duration) (string, error) {
+	return mockActivationToken, nil
+}
+
+func (m *UserModel) Activate(ctx context.Context, token string) error {
+	if token != mockActivationToken {
+		return models.ErrNoRecord
+	}
+	return nil
+}
@@ -1,16 +1,115 @@
 package models
 
 import (
+	"context"
 	"errors"
 	"time"
 )
 
-var ErrNoRecord = errors.New("models: подходящей записи не найдено")
+var (
+	ErrNoRecord = errors.New("models: подходящей записи не найдено")
+	// ErrDuplicateEmail возвращается при попытке зарегистрировать
+	// пользователя с уже существующим email адресом.
+	ErrDuplicateEmail = errors.New("models: дублирующийся email")
+	// ErrInvalidCredentials возвращается при неверном email или пароле.
+	ErrInvalidCredentials = errors.New("models: неверные учетные данные")
+	// ErrUserNotActivated возвращается при попытке войти в аккаунт,
+	// email адрес которого еще не подтвержден.
+	ErrUserNotActivated = errors.New("models: аккаунт не активирован")
+	// ErrDuplicateSnippet возвращается вместе с ID существующей заметки,
+	// если автор уже создал заметку с тем же заголовком и содержимым.
+	ErrDuplicateSnippet = errors.New("models: дублирующаяся заметка")
+	// ErrForbidden возвращается при попытке изменить запись, которая
+	// принадлежит другому пользователю.
+	ErrForbidden = errors.New("models: нет доступа к записи")
+)
+
+// Уровни видимости заметки.
+const (
+	// VisibilityPublic - заметка показывается в общих списках.
+	VisibilityPublic = "public"
+	// VisibilityUnlisted - заметка доступна только по прямой ссылке.
+	VisibilityUnlisted = "unlisted"
+	// VisibilityPrivate - заметка доступна только автору.
+	VisibilityPrivate = "private"
+)
 
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID      int       `json:"id"`
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+	Tags    []string  `json:"tags"`
+	// UserID - ID автора заметки или 0 для анонимных заметок.
+	UserID     int    `json:"user_id"`
+	Visibility string `json:"visibility"`
+	// Language - язык для подсветки синтаксиса или none для обычного текста.
+	Language string `json:"language"`
+	// ViewCount - количество просмотров страницы заметки.
+	ViewCount int `json:"view_count"`
+	// ForkedFrom - ID заметки, копией которой является эта заметка, или 0.
+	ForkedFrom int `json:"forked_from,omitempty"`
+}
+
+// NewSnippet - данные новой заметки для SnippetModelInterface.InsertBatch().
+// Expires - срок жизни в днях, "0" - без срока.
+type NewSnippet struct {
+	Title      string
+	Content    string
+	Expires    string
+	Visibility string
+	Language   string
+	Tags       []string
+}
+
+// Revision - предыдущая версия заметки, сохраненная перед её изменением.
+// Created - время, когда эта версия была заменена новой.
+type Revision struct {
+	ID        int
+	SnippetID int
+	Title     string
+	Content   string
+	Created   time.Time
+}
+
+type User struct {
+	ID             int
+	Name           string
+	Email          string
+	HashedPassword []byte
+	Created        time.Time
+	Activated      bool
+}
+
+// SnippetModelInterface описывает методы работы с заметками, которые
+// используют обработчики. Реализуется mysql.SnippetModel и mocks.SnippetModel.
+type SnippetModelInterface interface {
+	Insert(ctx context.Context, userID, forkedFrom int, title, content, expires, visibility, language string, tags []string) (int, error)
+	InsertBatch(ctx context.Context, userID int, snippets []NewSnippet) error
+	Get(ctx context.Context, id, viewerID int) (*Snippet, error)
+	GetByTag(ctx context.Context, tag string) ([]*Snippet, error)
+	Latest(ctx context.Context) ([]*Snippet, error)
+	LatestPaged(ctx context.Context, limit, offset int) ([]*Snippet, error)
+	LatestByUser(ctx context.Context, userID int) ([]*Snippet, error)
+	AllByUser(ctx context.Context, userID int) ([]*Snippet, error)
+	Search(ctx context.Context, query string) ([]*Snippet, error)
+	Count(ctx context.Context) (int, error)
+	Update(ctx context.Context, id int, title, content string, expires int) error
+	Extend(ctx context.Context, id, userID, days int) error
+	Delete(ctx context.Context, id int) error
+	DeleteExpired(ctx context.Context) (int64, error)
+	IncrementViews(ctx context.Context, id int) error
+	Revisions(ctx context.Context, snippetID int) ([]*Revision, error)
+}
+
+// UserModelInterface описывает методы работы с пользователями, которые
+// используют обработчики. Реализуется mysql.UserModel и mocks.UserModel.
+type UserModelInterface interface {
+	Insert(ctx context.Context, name, email, password string) (int, error)
+	Authenticate(ctx context.Context, email, password string) (int, error)
+	Get(ctx context.Context, id int) (*User, error)
+	PasswordUpdate(ctx context.Context, id int, currentPassword, newPassword string) error
+	NewActivationToken(ctx context.Context, userID int, ttl time.Duration) (string, error)
+	Activate(ctx context.Context, token string) error
 }
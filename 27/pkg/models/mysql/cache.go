@@ -0,0 +1,193 @@
+package mysql
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Slava02/SnippetBox/26/pkg/models"
+)
+
+// CachedSnippetModel оборачивает SnippetModel и хранит в памяти результаты
+// запросов для главной страницы (LatestPaged и Count) в течение TTL.
+// Любое изменение заметок сбрасывает кэш. При TTL <= 0 кэш отключен.
+// Хранится не больше maxCachedPages страниц, так как номер страницы
+// выбирает клиент.
+type CachedSnippetModel struct {
+	*SnippetModel
+	TTL time.Duration
+
+	mu sync.RWMutex
+	// gen увеличивается при каждом сбросе кэша. Результат запроса,
+	// начатого до сброса, не сохраняется, чтобы не вернуть в кэш
+	// устаревшие данные.
+	gen   uint64
+	pages map[[2]int]cachedPage
+	count *cachedCount
+}
+
+// maxCachedPages - максимальное количество страниц в кэше. Первые страницы
+// запрашиваются чаще всего и попадают в кэш раньше остальных.
+const maxCachedPages = 20
+
+type cachedPage struct {
+	snippets []*models.Snippet
+	expires  time.Time
+}
+
+type cachedCount struct {
+	n       int
+	expires time.Time
+}
+
+// Latest возвращает 10 последних заметок, используя кэш.
+func (c *CachedSnippetModel) Latest(ctx context.Context) ([]*models.Snippet, error) {
+	return c.LatestPaged(ctx, 10, 0)
+}
+
+// LatestPaged возвращает страницу последних заметок из кэша, а при его
+// отсутствии или устаревании - из базы данных.
+func (c *CachedSnippetModel) LatestPaged(ctx context.Context, limit, offset int) ([]*models.Snippet, error) {
+	if c.TTL <= 0 {
+		return c.SnippetModel.LatestPaged(ctx, limit, offset)
+	}
+
+	key := [2]int{limit, offset}
+
+	c.mu.RLock()
+	page, ok := c.pages[key]
+	gen := c.gen
+	c.mu.RUnlock()
+	if ok && time.Now().Before(page.expires) {
+		return page.snippets, nil
+	}
+
+	s, err := c.SnippetModel.LatestPaged(ctx, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.gen == gen {
+		if c.pages == nil {
+			c.pages = make(map[[2]int]cachedPage)
+		}
+		// Когда кэш заполнен, из него удаляются устаревшие страницы. Если
+		// места все равно нет, страница просто не кэшируется.
+		if _, ok := c.pages[key]; !ok && len(c.pages) >= maxCachedPages {
+			now := time.Now()
+			for k, p := range c.pages {
+				if !now.Before(p.expires) {
+					delete(c.pages, k)
+				}
+			}
+		}
+		if _, ok := c.pages[key]; ok || len(c.pages) < maxCachedPages {
+			c.pages[key] = cachedPage{snippets: s, expires: time.Now().Add(c.TTL)}
+		}
+	}
+	c.mu.Unlock()
+
+	return s, nil
+}
+
+// Count возвращает количество активных заметок, используя кэш.
+func (c *CachedSnippetModel) Count(ctx context.Context) (int, error) {
+	if c.TTL <= 0 {
+		return c.SnippetModel.Count(ctx)
+	}
+
+	c.mu.RLock()
+	cached := c.count
+	gen := c.gen
+	c.mu.RUnlock()
+	if cached != nil && time.Now().Before(cached.expires) {
+		return cached.n, nil
+	}
+
+	n, err := c.SnippetModel.Count(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	if c.gen == gen {
+		c.count = &cachedCount{n: n, expires: time.Now().Add(c.TTL)}
+	}
+	c.mu.Unlock()
+
+	return n, nil
+}
+
+// Insert добавляет заметку и сбрасывает кэш. Для найденного дубликата
+// возвращается его ID, а кэш остается без изменений.
+func (c *CachedSnippetModel) Insert(ctx context.Context, userID, forkedFrom int, title, content, expires, visibility, language string, tags []string) (int, error) {
+	id, err := c.SnippetModel.Insert(ctx, userID, forkedFrom, title, content, expires, visibility, language, tags)
+	if err != nil {
+		return id, err
+	}
+	c.Invalidate()
+	return id, nil
+}
+
+// InsertBatch добавляет заметки и сбрасывает кэш.
+func (c *CachedSnippetModel) InsertBatch(ctx context.Context, userID int, snippets []models.NewSnippet) error {
+	err := c.SnippetModel.InsertBatch(ctx, userID, snippets)
+	if err != nil {
+		return err
+	}
+	c.Invalidate()
+	return nil
+}
+
+// Update изменяет заметку и сбрасывает кэш.
+func (c *CachedSnippetModel) Update(ctx context.Context, id int, title, content string, expires int) error {
+	err := c.SnippetModel.Update(ctx, id, title, content, expires)
+	if err != nil {
+		return err
+	}
+	c.Invalidate()
+	return nil
+}
+
+// Extend продлевает срок жизни заметки и сбрасывает кэш.
+func (c *CachedSnippetModel) Extend(ctx context.Context, id, userID, days int) error {
+	err := c.SnippetModel.Extend(ctx, id, userID, days)
+	if err != nil {
+		return err
+	}
+	c.Invalidate()
+	return nil
+}
+
+// Delete удаляет заметку и сбрасывает кэш.
+func (c *CachedSnippetModel) Delete(ctx context.Context, id int) error {
+	err := c.SnippetModel.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+	c.Invalidate()
+	return nil
+}
+
+// DeleteExpired удаляет истекшие заметки и сбрасывает кэш, если что-то
+// было удалено.
+func (c *CachedSnippetModel) DeleteExpired(ctx context.Context) (int64, error) {
+	n, err := c.SnippetModel.DeleteExpired(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 {
+		c.Invalidate()
+	}
+	return n, nil
+}
+
+// Invalidate сбрасывает все закэшированные результаты.
+func (c *CachedSnippetModel) Invalidate() {
+	c.mu.Lock()
+	c.gen++
+	c.pages = nil
+	c.count = nil
+	c.mu.Unlock()
+}
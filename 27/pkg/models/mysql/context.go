@@ -0,0 +1,16 @@
+package mysql
+
+import (
+	"context"
+	"time"
+)
+
+// withTimeout возвращает контекст, ограниченный по времени значением timeout.
+// Нулевое значение timeout означает, что дополнительное ограничение не
+// применяется и действуют только ограничения родительского контекста.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -1,30 +1,115 @@
 package mysql
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"github.com/Slava02/SnippetBox/26/pkg/models"
+	"strings"
+	"time"
 )
 
 // SnippetModel - Определяем тип который обертывает пул подключения sql.DB
 type SnippetModel struct {
 	DB *sql.DB
+	// Replica - необязательный пул подключений к реплике только для чтения.
+	// Через неё выполняются запросы общих списков, поиска и Get(). Списки
+	// заметок пользователя и история изменений читаются из DB, чтобы автор
+	// сразу видел свои изменения. Если Replica равна nil, все запросы
+	// выполняются через DB.
+	Replica *sql.DB
+	// Timeout ограничивает время выполнения каждого метода модели.
+	Timeout time.Duration
+	// Dedupe включает поиск дубликатов в Insert(): если у автора уже есть
+	// активная заметка с тем же заголовком и содержимым, новая не создается.
+	Dedupe bool
 }
 
-// Insert - Метод для создания новой заметки в базе дынных.
-func (m *SnippetModel) Insert(title, content, expires string) (int, error) {
+// reader возвращает пул подключений для запросов на чтение.
+func (m *SnippetModel) reader() *sql.DB {
+	if m.Replica != nil {
+		return m.Replica
+	}
+	return m.DB
+}
+
+// Insert - Метод для создания новой заметки в базе дынных. Заметка и её теги
+// создаются в одной транзакции, поэтому ошибка на любом шаге не оставляет
+// в базе данных частично созданных записей.
+// Если userID равен 0, заметка сохраняется как анонимная, а срок жизни
+// expires, равный "0", означает, что заметка не удаляется. forkedFrom - ID
+// заметки, копией которой является новая, или 0.
+// Если включен Dedupe и у автора уже есть такая же активная заметка, метод
+// возвращает её ID вместе с ошибкой models.ErrDuplicateSnippet.
+func (m *SnippetModel) Insert(ctx context.Context, userID, forkedFrom int, title, content, expires, visibility, language string, tags []string) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var id int
+	err := inTx(ctx, m.DB, func(tx *sql.Tx) error {
+		var err error
+
+		// Анонимные заметки не проверяются: у них нет автора, которому
+		// принадлежал бы дубликат.
+		if m.Dedupe && userID > 0 {
+			id, err = findDuplicate(ctx, tx, userID, contentHash(title, content))
+			if err == nil {
+				return models.ErrDuplicateSnippet
+			}
+			if !errors.Is(err, models.ErrNoRecord) {
+				return err
+			}
+		}
+
+		id, err = insertSnippet(ctx, tx, userID, forkedFrom, title, content, expires, visibility, language, tags)
+		return err
+	})
+	if err != nil {
+		// Для дубликата возвращается ID уже существующей заметки.
+		if errors.Is(err, models.ErrDuplicateSnippet) {
+			return id, err
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// InsertBatch - Метод создает заметки пользователя userID в одной транзакции:
+// при ошибке любой из них не создается ни одна. Дубликаты не проверяются,
+// так как метод используется для восстановления заметок из резервной копии.
+func (m *SnippetModel) InsertBatch(ctx context.Context, userID int, snippets []models.NewSnippet) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	return inTx(ctx, m.DB, func(tx *sql.Tx) error {
+		for _, s := range snippets {
+			_, err := insertSnippet(ctx, tx, userID, 0, s.Title, s.Content, s.Expires, s.Visibility, s.Language, s.Tags)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// insertSnippet добавляет заметку и её теги в рамках транзакции tx и
+// возвращает ID созданной записи.
+func insertSnippet(ctx context.Context, tx *sql.Tx, userID, forkedFrom int, title, content, expires, visibility, language string, tags []string) (int, error) {
 	// Ниже будет SQL запрос, который мы хотим выполнить. Мы разделили его на две строки
 	// для удобства чтения (поэтому он окружен обратными кавычками
 	// вместо обычных двойных кавычек).
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-    VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+	stmt := `INSERT INTO snippets (user_id, forked_from, title, content, content_hash, visibility, language, created, expires)
+    VALUES(?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP(), IF(? = 0, NULL, DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY)))`
 
-	// Используем метод Exec() из встроенного пула подключений для выполнения
-	// запроса. Первый параметр это сам SQL запрос, за которым следует
-	// заголовок заметки, содержимое и срока жизни заметки. Этот
+	// Используем метод ExecContext() открытой транзакции для выполнения
+	// запроса. Первые параметры - это контекст и сам SQL запрос, за которыми следуют
+	// заголовок заметки, содержимое, его хеш, видимость, язык и срок жизни заметки. Этот
 	// метод возвращает объект sql.Result, который содержит некоторые основные
 	// данные о том, что произошло после выполнении запроса.
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	result, err := tx.ExecContext(ctx, stmt, sql.NullInt64{Int64: int64(userID), Valid: userID > 0}, sql.NullInt64{Int64: int64(forkedFrom), Valid: forkedFrom > 0}, title, content, contentHash(title, content), visibility, language, expires, expires)
 	if err != nil {
 		return 0, err
 	}
@@ -36,21 +121,46 @@ func (m *SnippetModel) Insert(title, content, expires string) (int, error) {
 		return 0, err
 	}
 
+	err = insertTags(ctx, tx, int(id), tags)
+	if err != nil {
+		return 0, err
+	}
+
 	// Возвращаемый ID имеет тип int64, поэтому мы конвертируем его в тип int
 	// перед возвратом из метода.
 	return int(id), nil
 }
 
 // Get - Метод для возвращения данных заметки по её идентификатору ID.
-func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
+// Приватная заметка возвращается только её автору viewerID, для остальных
+// метод возвращает models.ErrNoRecord, как если бы заметки не существовало.
+// Реплика может отставать от основной базы данных, поэтому только что
+// созданная или измененная заметка может там еще отсутствовать. Чтобы
+// автор сразу увидел свою заметку, при отсутствии заметки на реплике запрос
+// повторяется к основной базе данных.
+func (m *SnippetModel) Get(ctx context.Context, id, viewerID int) (*models.Snippet, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	s, err := m.get(ctx, m.reader(), id, viewerID)
+	if errors.Is(err, models.ErrNoRecord) && m.Replica != nil {
+		return m.get(ctx, m.DB, id, viewerID)
+	}
+	return s, err
+}
+
+// get загружает заметку id через пул подключений db.
+func (m *SnippetModel) get(ctx context.Context, db *sql.DB, id, viewerID int) (*models.Snippet, error) {
+
 	// SQL запрос для получения данных одной записи.
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-    WHERE expires > UTC_TIMESTAMP() AND id = ?`
+	stmt := `SELECT id, user_id, forked_from, title, content, visibility, language, view_count, created, expires FROM snippets
+    WHERE (expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted_at IS NULL AND id = ?
+    AND (visibility <> 'private' OR user_id = ?)`
 
-	// Используем метод QueryRow() для выполнения SQL запроса,
+	// Используем метод QueryRowContext() для выполнения SQL запроса,
 	// передавая ненадежную переменную id в качестве значения для плейсхолдера
 	// Возвращается указатель на объект sql.Row, который содержит данные записи.
-	row := m.DB.QueryRow(stmt, id)
+	row := db.QueryRowContext(ctx, stmt, id, viewerID)
 
 	// Инициализируем указатель на новую структуру Snippet.
 	s := &models.Snippet{}
@@ -60,7 +170,10 @@ func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
 	// для row.Scan - это указатели на место, куда требуется скопировать данные
 	// и количество аргументов должно быть точно таким же, как количество
 	// столбцов в таблице базы данных.
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	// Столбец user_id может содержать NULL для анонимных заметок, а
+	// forked_from - для заметок, которые не являются копиями.
+	var userID, forkedFrom sql.NullInt64
+	err := row.Scan(&s.ID, &userID, &forkedFrom, &s.Title, &s.Content, &s.Visibility, &s.Language, &s.ViewCount, &s.Created, nullableTime{&s.Expires})
 	if err != nil {
 		// Специально для этого случая, мы проверим при помощи функции errors.Is()
 		// если запрос был выполнен с ошибкой. Если ошибка обнаружена, то
@@ -72,27 +185,201 @@ func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
 		}
 	}
 
+	s.UserID = int(userID.Int64)
+	s.ForkedFrom = int(forkedFrom.Int64)
+
+	// Загружаем теги заметки.
+	s.Tags, err = tags(ctx, db, s.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Если все хорошо, возвращается объект Snippet.
 	return s, nil
 }
 
-// Latest - Метод возвращает последние 10 заметок.
-func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
+// GetByTag - Метод возвращает актуальные публичные заметки с указанным тегом.
+func (m *SnippetModel) GetByTag(ctx context.Context, tag string) ([]*models.Snippet, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `SELECT s.id, s.title, s.content, s.created, s.expires FROM snippets s
+    INNER JOIN snippet_tags st ON st.snippet_id = s.id
+    INNER JOIN tags t ON t.id = st.tag_id
+    WHERE t.name = ? AND (s.expires IS NULL OR s.expires > UTC_TIMESTAMP()) AND s.deleted_at IS NULL AND s.visibility = 'public'
+    ORDER BY s.created DESC`
+
+	rows, err := m.reader().QueryContext(ctx, stmt, normalizeTag(tag))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []*models.Snippet
+
+	for rows.Next() {
+		s := &models.Snippet{}
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, nullableTime{&s.Expires})
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// tags возвращает отсортированный список тегов заметки.
+func tags(ctx context.Context, db *sql.DB, snippetID int) ([]string, error) {
+	stmt := `SELECT t.name FROM tags t
+    INNER JOIN snippet_tags st ON st.tag_id = t.id
+    WHERE st.snippet_id = ? ORDER BY t.name`
+
+	rows, err := db.QueryContext(ctx, stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+
+	for rows.Next() {
+		var tag string
+		err = rows.Scan(&tag)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// insertTags привязывает теги к заметке в рамках транзакции tx,
+// создавая отсутствующие теги.
+func insertTags(ctx context.Context, tx *sql.Tx, snippetID int, tags []string) error {
+	seen := make(map[string]bool, len(tags))
+
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+
+		// Если тег уже существует, LAST_INSERT_ID(id) позволяет получить
+		// его ID через LastInsertId() так же, как для нового тега.
+		result, err := tx.ExecContext(ctx, `INSERT INTO tags (name) VALUES (?)
+        ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)`, tag)
+		if err != nil {
+			return err
+		}
+
+		tagID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO snippet_tags (snippet_id, tag_id) VALUES (?, ?)`, snippetID, tagID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// contentHash возвращает SHA-256 заголовка и содержимого заметки в виде
+// шестнадцатеричной строки. Перед вычислением убираются пробелы по краям
+// и различия в переводах строк, которые не видны пользователю.
+func contentHash(title, content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	sum := sha256.Sum256([]byte(strings.TrimSpace(title) + "\x00" + strings.TrimSpace(content)))
+	return hex.EncodeToString(sum[:])
+}
+
+// findDuplicate возвращает ID активной заметки пользователя userID с хешем
+// hash или models.ErrNoRecord, если такой нет. Строка пользователя
+// блокируется до конца транзакции, поэтому две одновременные отправки
+// одной формы не создадут две заметки.
+func findDuplicate(ctx context.Context, tx *sql.Tx, userID int, hash string) (int, error) {
+	var locked int
+	err := tx.QueryRowContext(ctx, `SELECT id FROM users WHERE id = ? FOR UPDATE`, userID).Scan(&locked)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	stmt := `SELECT id FROM snippets WHERE user_id = ? AND content_hash = ?
+    AND (expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted_at IS NULL
+    ORDER BY id DESC LIMIT 1`
+
+	var id int
+	err = tx.QueryRowContext(ctx, stmt, userID, hash).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrNoRecord
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+// nullableTime сканирует столбец datetime, который может содержать NULL,
+// в time.Time. NULL превращается в нулевое время: так хранятся заметки
+// без срока жизни.
+type nullableTime struct {
+	t *time.Time
+}
+
+func (n nullableTime) Scan(value interface{}) error {
+	var nt sql.NullTime
+	if err := nt.Scan(value); err != nil {
+		return err
+	}
+	*n.t = nt.Time
+	return nil
+}
+
+// normalizeTag приводит тег к единому виду: без пробелов по краям
+// и в нижнем регистре.
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// Latest - Метод возвращает последние 10 публичных заметок.
+func (m *SnippetModel) Latest(ctx context.Context) ([]*models.Snippet, error) {
+	return m.LatestPaged(ctx, 10, 0)
+}
+
+// LatestPaged - Метод возвращает limit последних публичных заметок, пропуская первые offset.
+func (m *SnippetModel) LatestPaged(ctx context.Context, limit, offset int) ([]*models.Snippet, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
 	// Пишем SQL запрос, который мы хотим выполнить.
 	stmt := `SELECT id, title, content, created, expires FROM snippets
-    WHERE expires > UTC_TIMESTAMP() ORDER BY created DESC LIMIT 10`
+    WHERE (expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted_at IS NULL AND visibility = 'public'
+    ORDER BY created DESC LIMIT ? OFFSET ?`
 
-	// Используем метод Query() для выполнения нашего SQL запроса.
+	// Используем метод QueryContext() для выполнения нашего SQL запроса.
 	// В ответ мы получим sql.Rows, который содержит результат нашего запроса.
-	rows, err := m.DB.Query(stmt)
+	rows, err := m.reader().QueryContext(ctx, stmt, limit, offset)
 	if err != nil {
 		return nil, err
 	}
 
 	// Откладываем вызов rows.Close(), чтобы быть уверенным, что набор результатов из sql.Rows
-	// правильно закроется перед вызовом метода Latest(). Этот оператор откладывания
-	// должен выполнится *после* проверки на наличие ошибки в методе Query().
-	// В противном случае, если Query() вернет ошибку, это приведет к панике
+	// правильно закроется перед выходом из метода. Этот оператор откладывания
+	// должен выполнится *после* проверки на наличие ошибки в методе QueryContext().
+	// В противном случае, если QueryContext() вернет ошибку, это приведет к панике
 	// так как он попытается закрыть набор результатов у которого значение: nil.
 	defer rows.Close()
 
@@ -110,7 +397,7 @@ func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
 		// должны быть указателями на место, куда требуется скопировать данные и
 		// количество аргументов должно быть точно таким же, как количество
 		// столбцов из таблицы базы данных, возвращаемых вашим SQL запросом.
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, nullableTime{&s.Expires})
 		if err != nil {
 			return nil, err
 		}
@@ -127,3 +414,329 @@ func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
 	// Если все в порядке, возвращаем срез с данными.
 	return snippets, nil
 }
+
+// LatestByUser - Метод возвращает все неудаленные заметки пользователя userID,
+// включая заметки с истекшим сроком жизни, начиная с самых новых.
+func (m *SnippetModel) LatestByUser(ctx context.Context, userID int) ([]*models.Snippet, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `SELECT id, title, visibility, view_count, created, expires FROM snippets
+    WHERE user_id = ? AND deleted_at IS NULL ORDER BY created DESC`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []*models.Snippet
+
+	for rows.Next() {
+		s := &models.Snippet{UserID: userID}
+		err = rows.Scan(&s.ID, &s.Title, &s.Visibility, &s.ViewCount, &s.Created, nullableTime{&s.Expires})
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// AllByUser - Метод возвращает все актуальные заметки пользователя userID
+// вместе с содержимым и тегами, начиная с самых старых. Используется для
+// выгрузки заметок.
+func (m *SnippetModel) AllByUser(ctx context.Context, userID int) ([]*models.Snippet, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `SELECT id, title, content, visibility, language, view_count, created, expires FROM snippets
+    WHERE user_id = ? AND (expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted_at IS NULL
+    ORDER BY id`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []*models.Snippet
+
+	for rows.Next() {
+		s := &models.Snippet{UserID: userID}
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Visibility, &s.Language, &s.ViewCount, &s.Created, nullableTime{&s.Expires})
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Теги загружаются после закрытия rows, чтобы не занимать второе
+	// подключение к базе данных.
+	for _, s := range snippets {
+		s.Tags, err = tags(ctx, m.DB, s.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return snippets, nil
+}
+
+// Search - Метод выполняет полнотекстовый поиск по заголовкам и содержимому
+// актуальных публичных заметок и возвращает до 10 наиболее релевантных результатов.
+func (m *SnippetModel) Search(ctx context.Context, query string) ([]*models.Snippet, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `SELECT id, title, content, created, expires FROM snippets
+    WHERE MATCH(title, content) AGAINST(? IN NATURAL LANGUAGE MODE)
+    AND (expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted_at IS NULL AND visibility = 'public' LIMIT 10`
+
+	rows, err := m.reader().QueryContext(ctx, stmt, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []*models.Snippet
+
+	for rows.Next() {
+		s := &models.Snippet{}
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, nullableTime{&s.Expires})
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// Count - Метод возвращает общее количество актуальных публичных заметок.
+func (m *SnippetModel) Count(ctx context.Context) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `SELECT COUNT(*) FROM snippets
+    WHERE (expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted_at IS NULL AND visibility = 'public'`
+
+	var n int
+	err := m.reader().QueryRowContext(ctx, stmt).Scan(&n)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// Update - Метод для изменения заголовка, содержимого и срока жизни существующей заметки.
+// Прежние заголовок и содержимое сохраняются в snippet_revisions в той же
+// транзакции, что и изменение.
+func (m *SnippetModel) Update(ctx context.Context, id int, title, content string, expires int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	return inTx(ctx, m.DB, func(tx *sql.Tx) error {
+		// FOR UPDATE блокирует строку заметки до конца транзакции, поэтому
+		// при одновременном изменении ни одна из версий не потеряется.
+		stmt := `SELECT title, content FROM snippets
+    WHERE id = ? AND (expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted_at IS NULL
+    FOR UPDATE`
+
+		var oldTitle, oldContent string
+		err := tx.QueryRowContext(ctx, stmt, id).Scan(&oldTitle, &oldContent)
+		if err != nil {
+			// Заметки с таким ID не существует, она удалена или её срок жизни
+			// уже истек.
+			if errors.Is(err, sql.ErrNoRows) {
+				return models.ErrNoRecord
+			}
+			return err
+		}
+
+		stmt = `INSERT INTO snippet_revisions (snippet_id, title, content, created)
+    VALUES(?, ?, ?, UTC_TIMESTAMP())`
+
+		_, err = tx.ExecContext(ctx, stmt, id, oldTitle, oldContent)
+		if err != nil {
+			return err
+		}
+
+		// Срок жизни пересчитывается от текущего момента так же, как в Insert(),
+		// 0 означает заметку без срока жизни. Истекшие заметки не обновляются.
+		stmt = `UPDATE snippets SET title = ?, content = ?, content_hash = ?,
+	    expires = IF(? = 0, NULL, DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))
+    WHERE id = ?`
+
+		_, err = tx.ExecContext(ctx, stmt, title, content, contentHash(title, content), expires, expires, id)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Extend - Метод продлевает срок жизни заметки id её автору userID на days
+// дней от текущего момента, 0 означает заметку без срока жизни. Срок
+// жизни только увеличивается: если заметка и так истекает позже, он не
+// меняется. Для истекшей или удаленной заметки возвращается ErrNoRecord,
+// а для чужой - ErrForbidden. Чужая приватная заметка считается
+// несуществующей, как и в Get(), чтобы ответ не раскрывал её наличие.
+func (m *SnippetModel) Extend(ctx context.Context, id, userID, days int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	return inTx(ctx, m.DB, func(tx *sql.Tx) error {
+		// FOR UPDATE не дает заметке истечь или быть удаленной между
+		// проверкой автора и изменением срока жизни.
+		stmt := `SELECT user_id, visibility FROM snippets
+    WHERE id = ? AND (expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted_at IS NULL
+    FOR UPDATE`
+
+		var owner sql.NullInt64
+		var visibility string
+		err := tx.QueryRowContext(ctx, stmt, id).Scan(&owner, &visibility)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return models.ErrNoRecord
+			}
+			return err
+		}
+		isOwner := owner.Valid && int(owner.Int64) == userID
+		if !isOwner && visibility == models.VisibilityPrivate {
+			return models.ErrNoRecord
+		}
+		if !isOwner {
+			return models.ErrForbidden
+		}
+
+		// GREATEST возвращает NULL, если один из аргументов NULL, поэтому
+		// заметка без срока жизни такой и остается.
+		stmt = `UPDATE snippets
+    SET expires = IF(? = 0, NULL, GREATEST(expires, DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY)))
+    WHERE id = ?`
+
+		_, err = tx.ExecContext(ctx, stmt, days, days, id)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Revisions - Метод возвращает сохраненные версии заметки snippetID, начиная
+// с самой новой.
+func (m *SnippetModel) Revisions(ctx context.Context, snippetID int) ([]*models.Revision, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `SELECT id, snippet_id, title, content, created FROM snippet_revisions
+    WHERE snippet_id = ? ORDER BY id DESC`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*models.Revision
+
+	for rows.Next() {
+		rev := &models.Revision{}
+		err = rows.Scan(&rev.ID, &rev.SnippetID, &rev.Title, &rev.Content, &rev.Created)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Delete - Метод для мягкого удаления заметки. Запись не удаляется из таблицы,
+// вместо этого в столбец deleted_at записывается время удаления.
+func (m *SnippetModel) Delete(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `UPDATE snippets SET deleted_at = UTC_TIMESTAMP() WHERE id = ? AND deleted_at IS NULL`
+
+	result, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	// Заметка не найдена или уже была удалена ранее.
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+// DeleteExpired - Метод окончательно удаляет анонимные заметки с истекшим
+// сроком жизни и возвращает количество удаленных записей. Истекшие заметки
+// пользователей остаются в базе данных, так как LatestByUser() показывает
+// их автору на странице аккаунта. Все остальные запросы их по-прежнему
+// не возвращают.
+func (m *SnippetModel) DeleteExpired(ctx context.Context) (int64, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `DELETE FROM snippets WHERE expires < UTC_TIMESTAMP() AND user_id IS NULL`
+
+	result, err := m.DB.ExecContext(ctx, stmt)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// IncrementViews - Метод увеличивает счетчик просмотров заметки на единицу.
+func (m *SnippetModel) IncrementViews(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `UPDATE snippets SET view_count = view_count + 1 WHERE id = ? AND deleted_at IS NULL`
+
+	result, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
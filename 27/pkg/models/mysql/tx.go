@@ -0,0 +1,74 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// txMaxRetries - сколько раз транзакция повторяется после взаимной
+// блокировки или истечения времени ожидания блокировки.
+const txMaxRetries = 3
+
+// txRetryBackoff - базовая пауза перед повтором транзакции. С каждой
+// попыткой она удваивается, а фактическая пауза выбирается случайно в
+// пределах от половины до полного значения, чтобы конкурирующие
+// транзакции не столкнулись снова.
+const txRetryBackoff = 20 * time.Millisecond
+
+// inTx выполняет fn в транзакции пула db и фиксирует её, если fn не
+// вернула ошибку. При взаимной блокировке (ошибка MySQL 1213) или
+// истечении времени ожидания блокировки (1205) транзакция откатывается
+// и выполняется заново до txMaxRetries раз, поэтому fn должна полностью
+// повторять свою работу при каждом вызове. Остальные ошибки возвращаются
+// сразу.
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	for attempt := 0; ; attempt++ {
+		err := runTx(ctx, db, fn)
+		if err == nil || attempt == txMaxRetries || !isLockError(err) {
+			return err
+		}
+
+		backoff := txRetryBackoff << attempt
+		timer := time.NewTimer(backoff/2 + rand.N(backoff/2))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// runTx выполняет одну попытку транзакции для inTx.
+func runTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback() после успешного Commit() ничего не делает, поэтому его
+	// можно безопасно отложить.
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// isLockError сообщает, что err - взаимная блокировка (1213) или истечение
+// времени ожидания блокировки (1205), после которых транзакцию можно
+// повторить.
+func isLockError(err error) bool {
+	var mySQLError *mysql.MySQLError
+	if errors.As(err, &mySQLError) {
+		return mySQLError.Number == 1213 || mySQLError.Number == 1205
+	}
+	return false
+}
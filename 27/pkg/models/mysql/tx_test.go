@@ -0,0 +1,135 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// fakeConnector создает подключения fakeConn и считает зафиксированные и
+// отмененные транзакции.
+type fakeConnector struct {
+	commits   int
+	rollbacks int
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) { return &fakeConn{c}, nil }
+func (c *fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("не поддерживается")
+}
+
+type fakeConn struct{ c *fakeConnector }
+
+func (fc *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("не поддерживается")
+}
+func (fc *fakeConn) Close() error              { return nil }
+func (fc *fakeConn) Begin() (driver.Tx, error) { return fakeTx{fc.c}, nil }
+
+type fakeTx struct{ c *fakeConnector }
+
+func (tx fakeTx) Commit() error   { tx.c.commits++; return nil }
+func (tx fakeTx) Rollback() error { tx.c.rollbacks++; return nil }
+
+func TestIsLockError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Взаимная блокировка", &mysql.MySQLError{Number: 1213}, true},
+		{"Истекло ожидание блокировки", &mysql.MySQLError{Number: 1205}, true},
+		{"Обернутая взаимная блокировка", fmt.Errorf("insert: %w", &mysql.MySQLError{Number: 1213}), true},
+		{"Дублирующаяся запись", &mysql.MySQLError{Number: 1062}, false},
+		{"Другая ошибка", errors.New("ошибка"), false},
+		{"Нет ошибки", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isLockError(tt.err); got != tt.want {
+				t.Errorf("isLockError(%v) = %t, ожидается %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInTx(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number: 1213}
+	lockWait := &mysql.MySQLError{Number: 1205}
+	other := errors.New("другая ошибка")
+
+	tests := []struct {
+		name         string
+		errs         []error
+		wantErr      error
+		wantAttempts int
+		wantCommits  int
+	}{
+		{"Успех с первой попытки", nil, nil, 1, 1},
+		{"Успех после блокировок", []error{deadlock, lockWait}, nil, 3, 1},
+		{"Блокировки на всех попытках", []error{deadlock, deadlock, lockWait, deadlock}, deadlock, txMaxRetries + 1, 0},
+		{"Другая ошибка не повторяется", []error{other}, other, 1, 0},
+		{"Другая ошибка после блокировки", []error{deadlock, other}, other, 2, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connector := &fakeConnector{}
+			db := sql.OpenDB(connector)
+			defer db.Close()
+
+			attempts := 0
+			err := inTx(context.Background(), db, func(tx *sql.Tx) error {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return tt.errs[attempts-1]
+				}
+				return nil
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ошибка %v, ожидается %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("попыток %d, ожидается %d", attempts, tt.wantAttempts)
+			}
+			if connector.commits != tt.wantCommits {
+				t.Errorf("фиксаций %d, ожидается %d", connector.commits, tt.wantCommits)
+			}
+			if connector.rollbacks != attempts-tt.wantCommits {
+				t.Errorf("откатов %d, ожидается %d", connector.rollbacks, attempts-tt.wantCommits)
+			}
+		})
+	}
+}
+
+func TestInTxCanceled(t *testing.T) {
+	db := sql.OpenDB(&fakeConnector{})
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	attempts := 0
+	err := inTx(ctx, db, func(tx *sql.Tx) error {
+		attempts++
+		cancel()
+		return &mysql.MySQLError{Number: 1213}
+	})
+
+	if !isLockError(err) {
+		t.Errorf("ошибка %v, ожидается ошибка блокировки", err)
+	}
+	if attempts != 1 {
+		t.Errorf("попыток %d, ожидается 1 после отмены контекста", attempts)
+	}
+}
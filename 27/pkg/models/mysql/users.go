@@ -0,0 +1,276 @@
+package mysql
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Slava02/SnippetBox/26/pkg/models"
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UserModel - Определяем тип который обертывает пул подключения sql.DB
+type UserModel struct {
+	DB *sql.DB
+	// Timeout ограничивает время выполнения каждого метода модели.
+	Timeout time.Duration
+	// BcryptCost - стоимость bcrypt для новых хешей паролей. Нулевое
+	// значение означает стоимость 12.
+	BcryptCost int
+	// ErrorLog получает ошибки, которые не мешают выполнению метода, например
+	// неудачное обновление хеша пароля при входе. Если ErrorLog равен nil,
+	// такие ошибки не записываются.
+	ErrorLog *log.Logger
+
+	dummyOnce sync.Once
+	dummyHash []byte
+}
+
+// bcryptCost возвращает стоимость bcrypt, с которой создаются хеши паролей.
+func (m *UserModel) bcryptCost() int {
+	if m.BcryptCost == 0 {
+		return 12
+	}
+	return m.BcryptCost
+}
+
+// dummyPasswordHash возвращает хеш случайного пароля с текущей стоимостью
+// bcrypt. С ним сравнивается пароль для неизвестного email, чтобы время
+// ответа Authenticate() не выдавало, зарегистрирован ли адрес.
+func (m *UserModel) dummyPasswordHash() []byte {
+	m.dummyOnce.Do(func() {
+		password := make([]byte, 16)
+		rand.Read(password)
+		m.dummyHash, _ = bcrypt.GenerateFromPassword(password, m.bcryptCost())
+	})
+	return m.dummyHash
+}
+
+// Insert - Метод для добавления нового пользователя в базу данных. Метод
+// возвращает ID созданного пользователя. Новый пользователь не активирован.
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	// Создаем bcrypt хеш пароля. В базе данных никогда не хранится
+	// сам пароль в открытом виде.
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), m.bcryptCost())
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `INSERT INTO users (name, email, hashed_password, created)
+    VALUES(?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.ExecContext(ctx, stmt, name, email, string(hashedPassword))
+	if err != nil {
+		// Если MySQL вернула ошибку 1062 (дублирующаяся запись) по уникальному
+		// индексу на email, возвращаем ошибку models.ErrDuplicateEmail.
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) {
+			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
+				return 0, models.ErrDuplicateEmail
+			}
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Authenticate - Метод проверяет email и пароль пользователя и возвращает его ID.
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var id int
+	var hashedPassword []byte
+	var activated bool
+
+	stmt := `SELECT id, hashed_password, activated FROM users WHERE email = ?`
+
+	err := m.DB.QueryRowContext(ctx, stmt, email).Scan(&id, &hashedPassword, &activated)
+	if err != nil {
+		// Неизвестный email и неверный пароль возвращают одну и ту же ошибку,
+		// чтобы не раскрывать, какие email адреса зарегистрированы. Пароль
+		// все равно сравнивается с хешем, чтобы ответ занимал столько же
+		// времени, сколько для существующего адреса.
+		if errors.Is(err, sql.ErrNoRows) {
+			bcrypt.CompareHashAndPassword(m.dummyPasswordHash(), []byte(password))
+			return 0, models.ErrInvalidCredentials
+		}
+		return 0, err
+	}
+
+	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return 0, models.ErrInvalidCredentials
+		}
+		return 0, err
+	}
+
+	// Состояние активации проверяется только после пароля, чтобы ошибка
+	// ErrUserNotActivated не раскрывала существование аккаунта.
+	if !activated {
+		return 0, models.ErrUserNotActivated
+	}
+
+	// Если хеш создан с меньшей стоимостью, чем настроена сейчас, пересоздаем
+	// его, пока пароль известен. Ошибка здесь не мешает входу: она только
+	// записывается в ErrorLog, а хеш будет обновлен при следующем входе.
+	if cost, err := bcrypt.Cost(hashedPassword); err == nil && cost < m.bcryptCost() {
+		err = m.rehashPassword(ctx, id, password)
+		if err != nil && m.ErrorLog != nil {
+			m.ErrorLog.Printf("обновление хеша пароля пользователя %d: %v", id, err)
+		}
+	}
+
+	return id, nil
+}
+
+// rehashPassword сохраняет новый хеш пароля пользователя id, созданный
+// с текущей стоимостью bcrypt.
+func (m *UserModel) rehashPassword(ctx context.Context, id int, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), m.bcryptCost())
+	if err != nil {
+		return err
+	}
+
+	stmt := `UPDATE users SET hashed_password = ? WHERE id = ?`
+
+	_, err = m.DB.ExecContext(ctx, stmt, string(hashedPassword), id)
+	return err
+}
+
+// Get - Метод возвращает данные пользователя по его ID.
+func (m *UserModel) Get(ctx context.Context, id int) (*models.User, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	u := &models.User{}
+
+	stmt := `SELECT id, name, email, created, activated FROM users WHERE id = ?`
+
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.Activated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// PasswordUpdate - Метод меняет пароль пользователя, предварительно проверив
+// текущий пароль.
+func (m *UserModel) PasswordUpdate(ctx context.Context, id int, currentPassword, newPassword string) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var currentHashedPassword []byte
+
+	stmt := `SELECT hashed_password FROM users WHERE id = ?`
+
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&currentHashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNoRecord
+		}
+		return err
+	}
+
+	err = bcrypt.CompareHashAndPassword(currentHashedPassword, []byte(currentPassword))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return models.ErrInvalidCredentials
+		}
+		return err
+	}
+
+	newHashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), m.bcryptCost())
+	if err != nil {
+		return err
+	}
+
+	stmt = `UPDATE users SET hashed_password = ? WHERE id = ?`
+
+	_, err = m.DB.ExecContext(ctx, stmt, string(newHashedPassword), id)
+	return err
+}
+
+// NewActivationToken - Метод создает токен активации пользователя userID,
+// действующий в течение ttl. В базе данных сохраняется только хеш токена,
+// а сам токен возвращается для отправки пользователю.
+func (m *UserModel) NewActivationToken(ctx context.Context, userID int, ttl time.Duration) (string, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	token := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(token))
+
+	stmt := `INSERT INTO tokens (hash, user_id, expiry) VALUES(?, ?, ?)`
+
+	_, err = m.DB.ExecContext(ctx, stmt, hash[:], userID, time.Now().UTC().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Activate - Метод активирует пользователя, которому принадлежит токен,
+// и удаляет все его токены активации. Если токен не найден или истек,
+// возвращается models.ErrNoRecord.
+func (m *UserModel) Activate(ctx context.Context, token string) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	hash := sha256.Sum256([]byte(token))
+
+	return inTx(ctx, m.DB, func(tx *sql.Tx) error {
+		var userID int
+
+		stmt := `SELECT user_id FROM tokens WHERE hash = ? AND expiry > UTC_TIMESTAMP() FOR UPDATE`
+
+		err := tx.QueryRowContext(ctx, stmt, hash[:]).Scan(&userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return models.ErrNoRecord
+			}
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE users SET activated = TRUE WHERE id = ?`, userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = ?`, userID)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
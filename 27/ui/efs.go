@@ -0,0 +1,10 @@
+// Package ui содержит HTML шаблоны и статические файлы веб-приложения.
+package ui
+
+import "embed"
+
+// Files встраивает шаблоны и статические файлы в исполняемый файл, чтобы
+// для развертывания приложения не нужно было копировать каталог ui.
+//
+//go:embed "html" "static"
+var Files embed.FS